@@ -0,0 +1,188 @@
+package listparser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBinary1(t *testing.T) {
+	st := NewSymbolTable()
+	src := `(rule "r1" (when (> x 10) (< y -2.5)) [a {b}])
+(rule "r2" 'quoted #"\x00\xff")`
+	lists, err := ParseStringWithOptions("rules.lsp", st, src, ParseOptions{NumericType: true, ReaderMacros: true, ByteStrings: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	for _, withPositions := range []bool{true, false} {
+		var b bytes.Buffer
+		if err := EncodeBinary(&b, st, lists, withPositions); err != nil {
+			t.Fatalf("Encode error with \"%v\"", err)
+		}
+		st2, lists2, err := DecodeBinary(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatalf("Decode error with \"%v\"", err)
+		}
+		if len(lists2) != len(lists) {
+			t.Fatalf("Unexpected number of lists %d", len(lists2))
+		}
+		for i := range lists {
+			if !Equal(lists[i], lists2[i]) {
+				t.Errorf("Not equal list %d", i)
+			}
+		}
+		if st2.GetSymbolID("when") != st.GetSymbolID("when") {
+			t.Error("Unexpected symbol ID")
+		}
+		pos := lists2[0].ElementAt(2).(*ListElement).ElementAt(1).Position()
+		if withPositions && pos != (Position{"rules.lsp", 1, 18}) {
+			t.Errorf("Unexpected position %v", pos)
+		} else if !withPositions && pos != (Position{}) {
+			t.Errorf("Unexpected position %v", pos)
+		}
+		if s, err := Sprint(st2, lists2[1]); err != nil || s != `(rule "r2" 'quoted #"\x00\xff")` {
+			t.Errorf("Unexpected result %s", s)
+		}
+	}
+}
+
+func TestBinaryErrors(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestBinaryErrors", st, `(a 1 "s")`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	var b bytes.Buffer
+	if err := EncodeBinary(&b, st, lists, true); err != nil {
+		t.Fatalf("Encode error with \"%v\"", err)
+	}
+	data := b.Bytes()
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-6] ^= 0xff
+	version := append([]byte{}, data...)
+	version[4] = 99
+	tests := []struct {
+		data []byte
+		err  error
+	}{
+		{corrupted, ErrorBinaryChecksumMismatch},
+		{version, ErrorUnsupportedBinaryVersion},
+		{data[:len(data)-1], ErrorBinaryChecksumMismatch},
+		{[]byte("LPTA\x01\x00\x00\x00\x00\x00"), ErrorInvalidBinaryFormat},
+	}
+	for i, test := range tests {
+		if _, _, err := DecodeBinary(bytes.NewReader(test.data)); err != test.err {
+			t.Errorf("Unexpected error \"%v\" for %d", err, i)
+		}
+	}
+}
+
+func TestBinaryDottedPairs(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestBinaryDottedPairs", st, `(a (b . 1) . [c . d])`, ParseOptions{NumericType: true, DottedPairs: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	var b bytes.Buffer
+	if err := EncodeBinary(&b, st, lists, true); err != nil {
+		t.Fatalf("Encode error with \"%v\"", err)
+	}
+	_, lists2, err := DecodeBinary(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode error with \"%v\"", err)
+	}
+	if !Equal(lists[0], lists2[0]) {
+		t.Error("Not equal list")
+	}
+	if tail, ok := lists2[0].Tail(); !ok || tail.Position() != (Position{"TestBinaryDottedPairs", 1, 14}) {
+		t.Error("Unexpected tail")
+	}
+}
+
+func TestBinaryShared(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestBinaryShared", st, `#0=(a #1=(b) #1# #0#)`, ParseOptions{DatumLabels: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	var b bytes.Buffer
+	if err := EncodeBinary(&b, st, lists, true); err != nil {
+		t.Fatalf("Encode error with \"%v\"", err)
+	}
+	_, lists2, err := DecodeBinary(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode error with \"%v\"", err)
+	}
+	lst := lists2[0]
+	if !Equal(lists[0], lst) || lst.ElementAt(1) != lst.ElementAt(2) || lst.ElementAt(3) != lst {
+		t.Error("Sharing was not preserved")
+	}
+}
+
+func TestBinaryTaggedLists(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestBinaryTaggedLists", st, `#rec(a #(1 . 2) #set{b})`, ParseOptions{NumericType: true, DottedPairs: true, TaggedLists: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	var b bytes.Buffer
+	if err := EncodeBinary(&b, st, lists, false); err != nil {
+		t.Fatalf("Encode error with \"%v\"", err)
+	}
+	st2, lists2, err := DecodeBinary(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode error with \"%v\"", err)
+	}
+	if !Equal(lists[0], lists2[0]) {
+		t.Error("Not equal list")
+	}
+	if s, err := Sprint(st2, lists2[0]); err != nil || s != "#rec(a #(1 . 2) #set{b})" {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+// benchmarkSource 規則を並べたベンチマーク用のソースコード
+func benchmarkSource() string {
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "(rule \"r%d\" (when (> x %d) (< y -2.5) (member z [a b c])) (then (set w %d) 'done))\n", i, i, i*3)
+	}
+	return b.String()
+}
+
+func BenchmarkParse(b *testing.B) {
+	src := benchmarkSource()
+	opts := ParseOptions{NumericType: true, ReaderMacros: true}
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseStringWithOptions("rules.lsp", NewSymbolTable(), src, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	src := benchmarkSource()
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("rules.lsp", st, src, ParseOptions{NumericType: true, ReaderMacros: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeBinary(&buf, st, lists, true); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	// 元のソースコードと同じ量を処理したものとして比較できるようにする。
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DecodeBinary(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package listparser
+
+// CloneOptions CloneWithOptionsの動作を指定する。
+type CloneOptions struct {
+	// From, To 両方を指定した場合、シンボルをFromで名前に戻してからToのIDに置き換える。
+	From *SymbolTable
+	To   *SymbolTable
+	// Filename 空でない場合、すべての要素の位置のファイル名をFilenameに置き換える。
+	Filename string
+}
+
+// Clone eと同じ値、同じ位置を持つ独立したコピーを返す。
+// 複数の場所から参照されているリストや循環したリストは、コピーでも同じ形で共有される。
+func Clone(e SyntaxElement) SyntaxElement {
+	c, _ := CloneWithOptions(e, CloneOptions{})
+	return c
+}
+
+// CloneWithOptions optsに従ってeのコピーを作る。
+// Fromに定義されていないシンボルがある場合はErrorInvalidSymbolIDを返す。
+func CloneWithOptions(e SyntaxElement, opts CloneOptions) (SyntaxElement, error) {
+	return clone(e, &opts, make(map[*ListElement]*ListElement))
+}
+
+// clone eのコピーを作る。clonesはコピー済みのリストとそのコピー。
+func clone(e SyntaxElement, opts *CloneOptions, clones map[*ListElement]*ListElement) (SyntaxElement, error) {
+	switch v := e.(type) {
+	case *ListElement:
+		if c, ok := clones[v]; ok {
+			return c, nil
+		}
+		c := *v
+		clones[v] = &c
+		c.pos = opts.rebase(v.pos)
+		c.elements = make([]SyntaxElement, len(v.elements))
+		for i, child := range v.elements {
+			cc, err := clone(child, opts, clones)
+			if err != nil {
+				return nil, err
+			}
+			c.elements[i] = cc
+		}
+		if v.tail != nil {
+			cc, err := clone(v.tail, opts, clones)
+			if err != nil {
+				return nil, err
+			}
+			c.tail = cc
+		}
+		if v.tag != nil && v.tag.value == InvalidSymbolID {
+			c.tag = &symbolIDElement{InvalidSymbolID, opts.rebase(v.tag.pos), ""}
+		} else if v.tag != nil {
+			cc, err := clone(v.tag, opts, clones)
+			if err != nil {
+				return nil, err
+			}
+			c.tag = cc.(*symbolIDElement)
+		}
+		return &c, nil
+	case *intElement:
+		c := *v
+		c.pos = opts.rebase(v.pos)
+		return &c, nil
+	case *floatElement:
+		c := *v
+		c.pos = opts.rebase(v.pos)
+		return &c, nil
+	case *stringElement:
+		c := *v
+		c.pos = opts.rebase(v.pos)
+		if v.block != nil {
+			c.block = &textBlock{opts.rebase(v.block.first), opts.rebase(v.block.last)}
+		}
+		return &c, nil
+	case *bytesElement:
+		c := *v
+		c.pos = opts.rebase(v.pos)
+		c.value = append([]byte(nil), v.value...)
+		return &c, nil
+	case *charElement:
+		c := *v
+		c.pos = opts.rebase(v.pos)
+		return &c, nil
+	case *symbolIDElement:
+		c := *v
+		c.pos = opts.rebase(v.pos)
+		if opts.From != nil && opts.To != nil {
+			name, err := opts.From.GetSymbolName(v.value)
+			if err != nil {
+				return nil, err
+			}
+			return newSymbol(opts.To, name, c.pos, c.raw)
+		}
+		return &c, nil
+	}
+	return e, nil
+}
+
+func (opts *CloneOptions) rebase(pos Position) Position {
+	if opts.Filename != "" {
+		pos.Filename = opts.Filename
+	}
+	return pos
+}
@@ -0,0 +1,102 @@
+package listparser
+
+import "testing"
+
+func TestClone1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestClone1", st, `(a 1 2.5 "s" [b {c}])`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	c := Clone(lists[0]).(*ListElement)
+	if c == lists[0] || !Equal(c, lists[0]) || c.Position() != lists[0].Position() {
+		t.Fatal("Unexpected clone")
+	}
+	c.elements[0] = &intElement{0, c.pos, ""}
+	inner := c.ElementAt(4).(*ListElement)
+	inner.elements = inner.elements[:1]
+	if !IsSymbol(lists[0].ElementAt(0)) || lists[0].ElementAt(4).(*ListElement).Len() != 2 {
+		t.Error("Original tree was modified")
+	}
+}
+
+func TestCloneWithOptions(t *testing.T) {
+	src := NewSymbolTable()
+	dst := NewSymbolTable()
+	dst.GetSymbolID("x")
+	dst.GetSymbolID("b")
+	lists, err := ParseString("include.lsp", src, `(a (b 1))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	e, err := CloneWithOptions(lists[0], CloneOptions{From: src, To: dst, Filename: "main.lsp"})
+	if err != nil {
+		t.Fatalf("Clone error with \"%v\"", err)
+	}
+	c := e.(*ListElement)
+	if !IsSymbolID(c.ElementAt(0), dst.GetSymbolID("a")) || c.ElementAt(0).Position().Filename != "main.lsp" {
+		t.Error("Unexpected symbol a")
+	}
+	inner := c.ElementAt(1).(*ListElement)
+	if !IsSymbolID(inner.ElementAt(0), dst.GetSymbolID("b")) || inner.ElementAt(1).Position() != (Position{"main.lsp", 1, 7}) {
+		t.Error("Unexpected symbol b")
+	}
+	if !EqualWithOptions(lists[0], c, EqualOptions{SymbolTableA: src, SymbolTableB: dst}) {
+		t.Error("Not equal by name")
+	}
+
+	if _, err := CloneWithOptions(lists[0], CloneOptions{From: NewSymbolTable(), To: dst}); err != ErrorInvalidSymbolID {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
+
+func TestCloneShared(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestCloneShared", st, `#0=(a #1=(b) #1# #0#)`, ParseOptions{DatumLabels: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	c := Clone(lists[0]).(*ListElement)
+	if c == lists[0] || !Equal(c, lists[0]) {
+		t.Fatal("Unexpected clone")
+	}
+	if c.ElementAt(1) != c.ElementAt(2) || c.ElementAt(1) == lists[0].ElementAt(1) || c.ElementAt(3) != c {
+		t.Error("Sharing was not preserved")
+	}
+}
+
+func TestCloneTaggedLists(t *testing.T) {
+	src := NewSymbolTable()
+	dst := NewSymbolTableWithNames("x")
+	lists, err := ParseStringWithOptions("TestCloneTaggedLists", src, `(#set(a))`, ParseOptions{TaggedLists: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	c, err := CloneWithOptions(lists[0], CloneOptions{From: src, To: dst})
+	if err != nil {
+		t.Fatalf("Clone error with \"%v\"", err)
+	}
+	if tag, ok := c.(*ListElement).ElementAt(0).(*ListElement).Tag(); !ok || tag != dst.GetSymbolID("set") {
+		t.Error("Unexpected tag")
+	}
+	if s, err := Sprint(dst, c); err != nil || s != "(#set(a))" {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestCloneToFrozenTable(t *testing.T) {
+	src := NewSymbolTable()
+	lists, err := ParseString("TestCloneToFrozenTable", src, `(a (b 1))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	dst := NewSymbolTableWithNames("a")
+	dst.Freeze()
+	_, err = CloneWithOptions(lists[0], CloneOptions{From: src, To: dst})
+	if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorUnknownSymbol || pe.ErrorLocation.Column != 5 {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	if dst.Len() != 1 {
+		t.Errorf("Unexpected symbols %d", dst.Len())
+	}
+}
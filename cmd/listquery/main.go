@@ -0,0 +1,83 @@
+// listquery パス式に一致する要素をファイルから取り出して表示する。
+//
+//	listquery [-s] [-p] query [file ...]
+//
+// ファイルを指定しない場合は標準入力を読む。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/healthy-tiger/listparser"
+)
+
+func main() {
+	stringAsSymbol := flag.Bool("s", false, "treat string literals as symbols")
+	showPosition := flag.Bool("p", false, "print the position of each element")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-s] [-p] query [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	st := listparser.NewSymbolTable()
+	q, err := listparser.CompileQuery(st, flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	status := 0
+	files := flag.Args()[1:]
+	if len(files) == 0 {
+		if err := query(os.Stdout, q, st, "<stdin>", os.Stdin, *stringAsSymbol, *showPosition); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	for _, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		err = query(os.Stdout, q, st, filename, f, *stringAsSymbol, *showPosition)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func query(w io.Writer, q *listparser.Query, st *listparser.SymbolTable, filename string, src io.Reader, stringAsSymbol bool, showPosition bool) error {
+	lists, err := listparser.Parse(filename, st, src, true, stringAsSymbol)
+	if err != nil {
+		return err
+	}
+	for _, r := range q.SelectAll(lists) {
+		s, err := listparser.Sprint(st, r.Element)
+		if err != nil {
+			return err
+		}
+		// 文字列はクオートせずにそのまま出力する。
+		if v, ok := r.Element.StringValue(); ok {
+			s = v
+		}
+		if showPosition {
+			fmt.Fprintf(w, "%v\t%s\n", r.Element.Position(), s)
+		} else {
+			fmt.Fprintln(w, s)
+		}
+	}
+	return nil
+}
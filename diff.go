@@ -0,0 +1,307 @@
+package listparser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// EditOp 編集操作の種類
+type EditOp int
+
+const (
+	// EditInsert 新しい木にだけある要素
+	EditInsert EditOp = iota
+	// EditDelete 古い木にだけある要素
+	EditDelete
+	// EditReplace 古い木の要素が新しい木の要素に置き換えられた。
+	EditReplace
+	// EditMove 古い木の要素が新しい木の別の場所に移動した。
+	EditMove
+)
+
+var editOpNames = map[EditOp]string{
+	EditInsert:  "insert",
+	EditDelete:  "delete",
+	EditReplace: "replace",
+	EditMove:    "move",
+}
+
+func (op EditOp) String() string {
+	return editOpNames[op]
+}
+
+// Edit 二つの木の違いを表す一つの編集操作
+type Edit struct {
+	Op EditOp
+	// OldPath 古い木での位置。EditInsertの場合はnil。
+	OldPath []int
+	// NewPath 新しい木での位置。EditDeleteの場合はnil。
+	NewPath []int
+	Old     SyntaxElement
+	New     SyntaxElement
+}
+
+// Diff oldListをnewListにする編集操作の並びを返す。要素は位置を無視してEqualで比較する。
+//
+// 子要素は、まず等しい要素同士を、次に先頭の要素が等しい同じ種類のカッコのリスト同士を対応付け、
+// 対応付けた要素の並びの最長増加部分列に含まれないものを移動(EditMove)とする。
+// 先頭の要素で対応付けたリストはさらに子要素を比較するので、EditMoveのOldとNewは等しいとは限らない。
+// 対応付かなかった要素は、同じ場所にあるもの同士をEditReplaceにして、残りをEditDeleteとEditInsertにする。
+// 最後に、削除された部分木と等しい部分木が別のリストに挿入されている場合もEditMoveにまとめる。
+func Diff(oldList, newList *ListElement) []Edit {
+	edits := make([]Edit, 0)
+	edits = diffElements(edits, make([]int, 0), make([]int, 0), oldList, newList, make(map[*ListElement]bool))
+	return detectMoves(edits)
+}
+
+// activeは比較している途中の古い側のリストで、循環したリストの比較を止めるために使う。
+func diffElements(edits []Edit, oldPath, newPath []int, a, b SyntaxElement, active map[*ListElement]bool) []Edit {
+	if Equal(a, b) {
+		return edits
+	}
+	la, oka := a.(*ListElement)
+	lb, okb := b.(*ListElement)
+	// タグかドット対の"."の後ろの要素が異なる場合と、循環して比較中のリストに戻った場合はリスト全体を置き換える。
+	if oka && okb && la.openchar == lb.openchar && sameTag(la, lb) && Equal(la.tail, lb.tail) && !active[la] {
+		return diffLists(edits, oldPath, newPath, la, lb, active)
+	}
+	return append(edits, Edit{EditReplace, appendPath(oldPath), appendPath(newPath), a, b})
+}
+
+// similarLists aとbが同じ種類のカッコとタグのリストで、先頭の要素と"."の後ろの要素が等しいか調べる。
+func similarLists(a, b SyntaxElement) bool {
+	la, oka := a.(*ListElement)
+	lb, okb := b.(*ListElement)
+	return oka && okb && la.openchar == lb.openchar && sameTag(la, lb) && Equal(la.tail, lb.tail) &&
+		la.Len() > 0 && lb.Len() > 0 && Equal(la.elements[0], lb.elements[0])
+}
+
+// sameTag aとbのタグが等しいか調べる。どちらもタグが付いていない場合も等しいとする。
+func sameTag(a, b *ListElement) bool {
+	ta, oka := a.Tag()
+	tb, okb := b.Tag()
+	return oka == okb && ta == tb
+}
+
+func diffLists(edits []Edit, oldPath, newPath []int, a, b *ListElement, active map[*ListElement]bool) []Edit {
+	active[a] = true
+	defer delete(active, a)
+	n, m := len(a.elements), len(b.elements)
+	oldPair := make([]int, n)
+	newPair := make([]int, m)
+	for i := range oldPair {
+		oldPair[i] = -1
+	}
+	for j := range newPair {
+		newPair[j] = -1
+	}
+
+	// 等しい要素同士を対応付ける。
+	byHash := make(map[uint64][]int)
+	for j, e := range b.elements {
+		h := Hash(e)
+		byHash[h] = append(byHash[h], j)
+	}
+	for i, e := range a.elements {
+		for _, j := range byHash[Hash(e)] {
+			if newPair[j] < 0 && Equal(e, b.elements[j]) {
+				oldPair[i], newPair[j] = j, i
+				break
+			}
+		}
+	}
+	// 残った要素のうち、先頭の要素が等しいリスト同士を対応付ける。
+	for i, e := range a.elements {
+		if oldPair[i] >= 0 {
+			continue
+		}
+		for j := range b.elements {
+			if newPair[j] < 0 && similarLists(e, b.elements[j]) {
+				oldPair[i], newPair[j] = j, i
+				break
+			}
+		}
+	}
+
+	// 対応付けた要素のうち、順番が変わっていないものを求める。
+	paired := make([]int, 0)
+	for i := range a.elements {
+		if oldPair[i] >= 0 {
+			paired = append(paired, i)
+		}
+	}
+	seq := make([]int, len(paired))
+	for k, i := range paired {
+		seq[k] = oldPair[i]
+	}
+	inPlace := make([]bool, n)
+	for k, ok := range longestIncreasing(seq) {
+		inPlace[paired[k]] = ok
+	}
+
+	// 順番が変わっていない要素の間を区間として、対応付かなかった要素を区間ごとにまとめる。
+	gapOld := make(map[int][]int)
+	gapNew := make(map[int][]int)
+	g := 0
+	for i := range a.elements {
+		if inPlace[i] {
+			g++
+		} else if oldPair[i] < 0 {
+			gapOld[g] = append(gapOld[g], i)
+		}
+	}
+	g = 0
+	for j := range b.elements {
+		if newPair[j] >= 0 && inPlace[newPair[j]] {
+			g++
+		} else if newPair[j] < 0 {
+			gapNew[g] = append(gapNew[g], j)
+		}
+	}
+	emitGap := func(g int) {
+		olds, news := gapOld[g], gapNew[g]
+		k := 0
+		for ; k < len(olds) && k < len(news); k++ {
+			edits = append(edits, Edit{EditReplace, appendPath(oldPath, olds[k]), appendPath(newPath, news[k]), a.elements[olds[k]], b.elements[news[k]]})
+		}
+		for _, i := range olds[k:] {
+			edits = append(edits, Edit{EditDelete, appendPath(oldPath, i), nil, a.elements[i], nil})
+		}
+		for _, j := range news[k:] {
+			edits = append(edits, Edit{EditInsert, nil, appendPath(newPath, j), nil, b.elements[j]})
+		}
+	}
+
+	g = 0
+	for i, e := range a.elements {
+		j := oldPair[i]
+		if inPlace[i] {
+			emitGap(g)
+			g++
+			edits = diffElements(edits, appendPath(oldPath, i), appendPath(newPath, j), e, b.elements[j], active)
+		} else if j >= 0 {
+			edits = append(edits, Edit{EditMove, appendPath(oldPath, i), appendPath(newPath, j), e, b.elements[j]})
+			if !Equal(e, b.elements[j]) && !active[e.(*ListElement)] {
+				edits = diffLists(edits, appendPath(oldPath, i), appendPath(newPath, j), e.(*ListElement), b.elements[j].(*ListElement), active)
+			}
+		}
+	}
+	emitGap(g)
+	return edits
+}
+
+// longestIncreasing seqの最長増加部分列に含まれる要素にtrueを設定したスライスを返す。
+func longestIncreasing(seq []int) []bool {
+	// tails[k]は長さk+1の増加部分列の末尾の値が最小になるときの末尾の添字
+	tails := make([]int, 0)
+	prev := make([]int, len(seq))
+	for i, v := range seq {
+		lo, hi := 0, len(tails)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if seq[tails[mid]] < v {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = tails[lo-1]
+		}
+		if lo == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[lo] = i
+		}
+	}
+	result := make([]bool, len(seq))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			result[i] = true
+		}
+	}
+	return result
+}
+
+// detectMoves 等しい要素の削除と挿入の組をEditMoveにまとめる。
+// 挿入が対応する削除より前にあっても二重に出力しないように、先に組を決めてから結果を作る。
+func detectMoves(edits []Edit) []Edit {
+	inserted := make(map[uint64][]int)
+	for k, e := range edits {
+		if e.Op == EditInsert {
+			h := Hash(e.New)
+			inserted[h] = append(inserted[h], k)
+		}
+	}
+	moveTo := make(map[int]int) // 削除の位置から対応する挿入の位置
+	moved := make(map[int]bool)
+	for k, e := range edits {
+		if e.Op != EditDelete {
+			continue
+		}
+		h := Hash(e.Old)
+		for n, ik := range inserted[h] {
+			if Equal(e.Old, edits[ik].New) {
+				moveTo[k] = ik
+				moved[ik] = true
+				inserted[h] = append(inserted[h][:n], inserted[h][n+1:]...)
+				break
+			}
+		}
+	}
+	result := make([]Edit, 0, len(edits))
+	for k, e := range edits {
+		if e.Op == EditInsert && moved[k] {
+			continue
+		}
+		if ik, ok := moveTo[k]; ok {
+			e = Edit{EditMove, e.OldPath, edits[ik].NewPath, e.Old, edits[ik].New}
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// FormatDiff editsを一行に一つずつ読みやすい形式でwに書き出す。シンボル名はstから取得する。
+//
+//	delete  old.lsp:2:3  (x 1)
+//	insert  new.lsp:2:3  (y 1)
+//	replace old.lsp:1:5 -> new.lsp:1:5  80 => 8080
+//	move    old.lsp:3:1 -> new.lsp:5:1  (z)
+func FormatDiff(w io.Writer, st *SymbolTable, edits []Edit) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range edits {
+		var err error
+		switch e.Op {
+		case EditInsert:
+			err = formatEdit(bw, st, "%-7s %v  %s\n", e.Op, e.New.Position(), e.New)
+		case EditDelete:
+			err = formatEdit(bw, st, "%-7s %v  %s\n", e.Op, e.Old.Position(), e.Old)
+		case EditReplace:
+			err = formatEdit(bw, st, "%-7s %v -> %v  %s => %s\n", e.Op, e.Old.Position(), e.New.Position(), e.Old, e.New)
+		case EditMove:
+			err = formatEdit(bw, st, "%-7s %v -> %v  %s\n", e.Op, e.Old.Position(), e.New.Position(), e.Old)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// formatEdit argsに含まれる構文要素をSprintで文字列にしてからfmt.Fprintfで書き出す。
+func formatEdit(w io.Writer, st *SymbolTable, format string, args ...interface{}) error {
+	for i, arg := range args {
+		if e, ok := arg.(SyntaxElement); ok {
+			s, err := Sprint(st, e)
+			if err != nil {
+				return err
+			}
+			args[i] = s
+		}
+	}
+	_, err := fmt.Fprintf(w, format, args...)
+	return err
+}
@@ -0,0 +1,139 @@
+package listparser
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestDiff1(t *testing.T) {
+	st := NewSymbolTable()
+	a, err := ParseString("old", st, `(config (server (port 80) (host "a")) (log debug) (user x))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	b, err := ParseString("new", st, `(config
+  (user x)
+  (server (port 8080)
+          (host "a"))
+  (cache on))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	edits := Diff(a[0], b[0])
+	expected := []struct {
+		op      EditOp
+		oldPath string
+		newPath string
+	}{
+		{EditMove, "[1]", "[2]"},
+		{EditReplace, "[1 1 1]", "[2 1 1]"},
+		{EditDelete, "[2]", "[]"},
+		{EditInsert, "[]", "[3]"},
+	}
+	if len(edits) != len(expected) {
+		t.Fatalf("Unexpected edits %v", edits)
+	}
+	for i, e := range expected {
+		if edits[i].Op != e.op || fmt.Sprint(edits[i].OldPath) != e.oldPath || fmt.Sprint(edits[i].NewPath) != e.newPath {
+			t.Errorf("Unexpected edit %v %v %v", edits[i].Op, edits[i].OldPath, edits[i].NewPath)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := FormatDiff(&buf, st, edits); err != nil {
+		t.Fatalf("Format error with \"%v\"", err)
+	}
+	text := `move    old:1:9 -> new:3:3  (server (port 80) (host "a"))
+replace old:1:23 -> new:3:17  80 => 8080
+delete  old:1:39  (log debug)
+insert  new:5:3  (cache on)
+`
+	if buf.String() != text {
+		t.Errorf("Unexpected diff\n%s", buf.String())
+	}
+}
+
+func TestDiffReflow(t *testing.T) {
+	st := NewSymbolTable()
+	a, err := ParseString("old", st, `(a (b c) d)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	b, err := ParseString("new", st, `(a
+  (b
+    c)
+  d)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if edits := Diff(a[0], b[0]); len(edits) != 0 {
+		t.Errorf("Unexpected edits %v", edits)
+	}
+}
+
+func TestDiffInsertDelete(t *testing.T) {
+	st := NewSymbolTable()
+	a, err := ParseString("old", st, `(a b c)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	b, err := ParseString("new", st, `(a c d e)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	edits := Diff(a[0], b[0])
+	if len(edits) != 3 || edits[0].Op != EditDelete || edits[1].Op != EditInsert || edits[2].Op != EditInsert {
+		t.Errorf("Unexpected edits %v", edits)
+	}
+	if fmt.Sprint(edits[0].OldPath) != "[1]" || fmt.Sprint(edits[2].NewPath) != "[3]" {
+		t.Errorf("Unexpected paths %v", edits)
+	}
+}
+
+func TestDiffMoveBetweenLists(t *testing.T) {
+	st := NewSymbolTable()
+	a, err := ParseString("old", st, `((a (x 1)) (b))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	b, err := ParseString("new", st, `((a) (b (x 1)))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	edits := Diff(a[0], b[0])
+	if len(edits) != 1 || edits[0].Op != EditMove || fmt.Sprint(edits[0].OldPath) != "[0 1]" || fmt.Sprint(edits[0].NewPath) != "[1 1]" {
+		t.Errorf("Unexpected edits %v", edits)
+	}
+}
+
+func TestDiffMoveBeforeDelete(t *testing.T) {
+	st := NewSymbolTable()
+	a, err := ParseString("old", st, `(p (q) (r (big 1 2 3)))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	b, err := ParseString("new", st, `(p (q (big 1 2 3)) (r))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	// 挿入が削除より前に出てくる場合も、移動だけになる。
+	edits := Diff(a[0], b[0])
+	if len(edits) != 1 || edits[0].Op != EditMove || fmt.Sprint(edits[0].OldPath) != "[2 1]" || fmt.Sprint(edits[0].NewPath) != "[1 1]" {
+		t.Errorf("Unexpected edits %v", edits)
+	}
+}
+
+func TestDiffCycles(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestDiffCycles", st, `#0=(x #0# 1) #0=(x #0# 2)`, ParseOptions{NumericType: true, DatumLabels: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	// 循環して比較中のリストに戻った要素は、リスト全体の置き換えになる。
+	edits := Diff(lists[0], lists[1])
+	if len(edits) != 2 || edits[0].Op != EditReplace || fmt.Sprint(edits[0].OldPath) != "[1]" || fmt.Sprint(edits[1].OldPath) != "[2]" {
+		t.Errorf("Unexpected edits %v", edits)
+	}
+}
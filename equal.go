@@ -0,0 +1,203 @@
+package listparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+)
+
+// EqualOptions EqualWithOptionsの比較方法を指定する。
+type EqualOptions struct {
+	// FloatTolerance 浮動小数点数の差の絶対値がこの値以下なら等しいとみなす。
+	FloatTolerance float64
+	// SymbolTableA, SymbolTableB 両方を指定した場合、aのシンボルはSymbolTableAで、
+	// bのシンボルはSymbolTableBで名前を引いて、IDではなく名前で比較する。
+	SymbolTableA *SymbolTable
+	SymbolTableB *SymbolTable
+}
+
+// Equal aとbが同じ値と同じ種類のカッコからなるか調べる。位置は比較しない。
+func Equal(a, b SyntaxElement) bool {
+	return EqualWithOptions(a, b, EqualOptions{})
+}
+
+// EqualWithOptions optsに従ってaとbが等しいか調べる。
+// 祖先のリストを参照する循環した要素は、どちらも同じ深さの祖先を参照している場合に等しいとする。
+func EqualWithOptions(a, b SyntaxElement, opts EqualOptions) bool {
+	return equal(a, b, opts, make([]*ListElement, 0), make([]*ListElement, 0))
+}
+
+// indexOfList ancestorsの中でlstが現れる位置を返す。現れない場合は-1を返す。
+func indexOfList(ancestors []*ListElement, lst *ListElement) int {
+	for i, a := range ancestors {
+		if a == lst {
+			return i
+		}
+	}
+	return -1
+}
+
+func equal(a, b SyntaxElement, opts EqualOptions, ancestorsA, ancestorsB []*ListElement) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch va := a.(type) {
+	case *ListElement:
+		vb, ok := b.(*ListElement)
+		if !ok {
+			return false
+		}
+		if ia, ib := indexOfList(ancestorsA, va), indexOfList(ancestorsB, vb); ia >= 0 || ib >= 0 {
+			return ia == ib
+		}
+		if va.openchar != vb.openchar || len(va.elements) != len(vb.elements) || (va.tag == nil) != (vb.tag == nil) {
+			return false
+		}
+		if va.tag != nil && !equal(va.tag, vb.tag, opts, ancestorsA, ancestorsB) {
+			return false
+		}
+		ancestorsA, ancestorsB = append(ancestorsA, va), append(ancestorsB, vb)
+		for i := range va.elements {
+			if !equal(va.elements[i], vb.elements[i], opts, ancestorsA, ancestorsB) {
+				return false
+			}
+		}
+		return equal(va.tail, vb.tail, opts, ancestorsA, ancestorsB)
+	case *intElement:
+		vb, ok := b.(*intElement)
+		return ok && va.value == vb.value
+	case *floatElement:
+		vb, ok := b.(*floatElement)
+		if !ok {
+			return false
+		}
+		if opts.FloatTolerance > 0 {
+			return math.Abs(va.value-vb.value) <= opts.FloatTolerance
+		}
+		return va.value == vb.value
+	case *stringElement:
+		vb, ok := b.(*stringElement)
+		return ok && va.value == vb.value
+	case *bytesElement:
+		vb, ok := b.(*bytesElement)
+		return ok && bytes.Equal(va.value, vb.value)
+	case *charElement:
+		vb, ok := b.(*charElement)
+		return ok && va.value == vb.value
+	case *symbolIDElement:
+		vb, ok := b.(*symbolIDElement)
+		if !ok {
+			return false
+		}
+		if opts.SymbolTableA != nil && opts.SymbolTableB != nil {
+			na, erra := opts.SymbolTableA.GetSymbolName(va.value)
+			nb, errb := opts.SymbolTableB.GetSymbolName(vb.value)
+			return erra == nil && errb == nil && na == nb
+		}
+		return va.value == vb.value
+	}
+	return false
+}
+
+// 構造ハッシュで要素の種類を区別するための値
+const (
+	hashList   = iota
+	hashInt    = iota
+	hashFloat  = iota
+	hashString = iota
+	hashSymbol = iota
+	hashBytes  = iota
+	hashChar   = iota
+	hashTail   = iota
+	hashCycle  = iota
+	hashTag    = iota
+)
+
+// Hash eの値とカッコの種類から計算したハッシュ値を返す。位置は含まない。
+// Equal(a, b)ならばHash(a) == Hash(b)となる。FloatToleranceを指定した比較とは対応しない。
+func Hash(e SyntaxElement) uint64 {
+	h := fnv.New64a()
+	writeHash(h, nil, make([]*ListElement, 0), e)
+	return h.Sum64()
+}
+
+// HashWithTable シンボルをIDではなくstから引いた名前でハッシュ値を計算する。
+// SymbolTableAとSymbolTableBを指定したEqualWithOptionsと対応する。
+func HashWithTable(st *SymbolTable, e SyntaxElement) uint64 {
+	h := fnv.New64a()
+	writeHash(h, st, make([]*ListElement, 0), e)
+	return h.Sum64()
+}
+
+func writeHash(h hash.Hash64, st *SymbolTable, ancestors []*ListElement, e SyntaxElement) {
+	var buf [binary.MaxVarintLen64 + 1]byte
+	switch v := e.(type) {
+	case *ListElement:
+		if i := indexOfList(ancestors, v); i >= 0 {
+			// 循環参照は参照する祖先の深さだけを含める。
+			buf[0] = hashCycle
+			n := binary.PutUvarint(buf[1:], uint64(i))
+			h.Write(buf[:n+1])
+			return
+		}
+		if v.tag != nil {
+			buf[0] = hashTag
+			h.Write(buf[:1])
+			writeHash(h, st, ancestors, v.tag)
+		}
+		buf[0] = hashList
+		buf[1] = byte(v.openchar)
+		n := binary.PutUvarint(buf[2:], uint64(len(v.elements)))
+		h.Write(buf[:n+2])
+		ancestors = append(ancestors, v)
+		for _, child := range v.elements {
+			writeHash(h, st, ancestors, child)
+		}
+		if v.tail != nil {
+			buf[0] = hashTail
+			h.Write(buf[:1])
+			writeHash(h, st, ancestors, v.tail)
+		}
+	case *intElement:
+		buf[0] = hashInt
+		n := binary.PutVarint(buf[1:], v.value)
+		h.Write(buf[:n+1])
+	case *floatElement:
+		buf[0] = hashFloat
+		f := v.value
+		if f == 0 {
+			// -0.0と0.0は等しいので同じハッシュ値にする。
+			f = 0
+		}
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(f))
+		h.Write(buf[:9])
+	case *stringElement:
+		writeHashString(h, hashString, v.value)
+	case *bytesElement:
+		writeHashString(h, hashBytes, string(v.value))
+	case *charElement:
+		buf[0] = hashChar
+		n := binary.PutVarint(buf[1:], int64(v.value))
+		h.Write(buf[:n+1])
+	case *symbolIDElement:
+		if st != nil {
+			if name, err := st.GetSymbolName(v.value); err == nil {
+				writeHashString(h, hashSymbol, name)
+				return
+			}
+		}
+		buf[0] = hashSymbol
+		n := binary.PutVarint(buf[1:], int64(v.value))
+		h.Write(buf[:n+1])
+	}
+}
+
+func writeHashString(h hash.Hash64, kind byte, s string) {
+	var buf [binary.MaxVarintLen64 + 1]byte
+	buf[0] = kind
+	n := binary.PutUvarint(buf[1:], uint64(len(s)))
+	h.Write(buf[:n+1])
+	h.Write([]byte(s))
+}
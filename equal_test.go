@@ -0,0 +1,73 @@
+package listparser
+
+import "testing"
+
+func TestEqual1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestEqual1", st, `(a 1 2.0 "s" [b {c}])
+(a   1 2.0 "s"
+  [b {c}])
+(a 1 2.0 "s" (b {c}))
+(a 1 2 "s" [b {c}])
+(a 1 2.0000001 "s" [b {c}])`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if !Equal(lists[0], lists[1]) || Hash(lists[0]) != Hash(lists[1]) {
+		t.Error("Not equal")
+	}
+	for i := 2; i < len(lists); i++ {
+		if Equal(lists[0], lists[i]) {
+			t.Errorf("Equal to list %d", i)
+		}
+		if Hash(lists[0]) == Hash(lists[i]) {
+			t.Errorf("Same hash as list %d", i)
+		}
+	}
+	if !EqualWithOptions(lists[0], lists[4], EqualOptions{FloatTolerance: 1e-6}) {
+		t.Error("Not equal with tolerance")
+	}
+}
+
+func TestEqualSymbolTables(t *testing.T) {
+	st1 := NewSymbolTable()
+	st2 := NewSymbolTable()
+	st2.GetSymbolID("x")
+	l1, err := ParseString("TestEqualSymbolTables", st1, `(a (b))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	l2, err := ParseString("TestEqualSymbolTables", st2, `(a (b))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if Equal(l1[0], l2[0]) {
+		t.Error("Equal by ID")
+	}
+	if !EqualWithOptions(l1[0], l2[0], EqualOptions{SymbolTableA: st1, SymbolTableB: st2}) {
+		t.Error("Not equal by name")
+	}
+	if HashWithTable(st1, l1[0]) != HashWithTable(st2, l2[0]) {
+		t.Error("Different hash by name")
+	}
+}
+
+func TestEqualCycles(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestEqualCycles", st, `#0=(a #0#)
+#0=(a #0#)
+#0=(a #1=(a #0#))
+#0=(a #1=(a #1#))`, ParseOptions{DatumLabels: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if !Equal(lists[0], lists[1]) || Hash(lists[0]) != Hash(lists[1]) {
+		t.Error("Same cycles are not equal")
+	}
+	if Equal(lists[2], lists[3]) || Hash(lists[2]) == Hash(lists[3]) {
+		t.Error("Different cycles are equal")
+	}
+	if Equal(lists[0], lists[2]) {
+		t.Error("Cycles of different depth are equal")
+	}
+}
@@ -0,0 +1,107 @@
+package listparser
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrorList 複数のファイルをパースしたときに発生したエラーの並び
+type ErrorList []error
+
+func (errs ErrorList) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap errsに含まれるエラーを返す。
+func (errs ErrorList) Unwrap() []error {
+	return errs
+}
+
+// ParseFile pathのファイルをoptsに従ってパースして*Listの配列を返す。
+// 空のファイルはエラーにせず、空の配列を返す。
+func ParseFile(path string, st *SymbolTable, opts ParseOptions) ([]*ListElement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseFileContents(path, st, f, opts)
+}
+
+// ParseFS fsysの中でpatternに一致するファイルをすべてパースし、ファイル名をキーにして結果を返す。
+// すべてのファイルのシンボルは同じstに登録される。
+// concurrencyが1より大きい場合は最大でその数のファイルを並行してパースするので、シンボルIDの割り当て順は一定にならない。
+// 空のファイルの結果は空の配列になる。パースに失敗したファイルは結果に含まれず、そのエラーはファイル名の順にErrorListにまとめて返される。
+func ParseFS(fsys fs.FS, pattern string, st *SymbolTable, opts ParseOptions, concurrency int) (map[string][]*ListElement, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make(map[string][]*ListElement)
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			lists, err := parseFSFile(fsys, name, st, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[name] = err
+			} else {
+				results[name] = lists
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return results, nil
+	}
+	failed := make([]string, 0, len(errs))
+	for name := range errs {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	el := make(ErrorList, len(failed))
+	for i, name := range failed {
+		el[i] = errs[name]
+	}
+	return results, el
+}
+
+func parseFSFile(fsys fs.FS, name string, st *SymbolTable, opts ParseOptions) ([]*ListElement, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseFileContents(name, st, f, opts)
+}
+
+// parseFileContents ParseWithOptionsと同じだが、空のファイルをio.EOFではなく空の配列にする。
+func parseFileContents(filename string, st *SymbolTable, src io.Reader, opts ParseOptions) ([]*ListElement, error) {
+	lists, err := ParseWithOptions(filename, st, src, opts)
+	if err == io.EOF {
+		// 空のファイル
+		return make([]*ListElement, 0), nil
+	}
+	return lists, err
+}
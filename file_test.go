@@ -0,0 +1,88 @@
+package listparser
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"conf/a.lsp":           {Data: []byte("(server a)\n(include \"common/base.lsp\")")},
+	"conf/b.lsp":           {Data: []byte("(server b)")},
+	"conf/broken.lsp":      {Data: []byte("(server")},
+	"conf/broken2.lsp":     {Data: []byte(")")},
+	"conf/common/base.lsp": {Data: []byte("(base)")},
+	"other.txt":            {Data: []byte("text")},
+}
+
+func TestParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lsp")
+	if err := os.WriteFile(path, []byte("(a 1)\n(b 2)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := NewSymbolTable()
+	lists, err := ParseFile(path, st, ParseOptions{NumericType: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if len(lists) != 2 || lists[1].Position() != (Position{path, 2, 1}) {
+		t.Errorf("Unexpected result %v", lists)
+	}
+	if _, err := ParseFile(path+".missing", st, ParseOptions{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
+
+func TestParseEmptyFile(t *testing.T) {
+	st := NewSymbolTable()
+	for _, data := range []string{"", " ; comment\n"} {
+		path := filepath.Join(t.TempDir(), "empty.lsp")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		lists, err := ParseFile(path, st, ParseOptions{})
+		if err != nil || lists == nil || len(lists) != 0 {
+			t.Errorf("Unexpected result %v, %v for %q", lists, err, data)
+		}
+	}
+
+	fsys := fstest.MapFS{"empty.lsp": {Data: []byte{}}, "a.lsp": {Data: []byte("(a)")}}
+	results, err := ParseFS(fsys, "*.lsp", st, ParseOptions{}, 1)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if lists, ok := results["empty.lsp"]; !ok || len(lists) != 0 || len(results["a.lsp"]) != 1 {
+		t.Errorf("Unexpected results %v", results)
+	}
+}
+
+func TestParseFS(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		st := NewSymbolTable()
+		results, err := ParseFS(testFS, "conf/*.lsp", st, ParseOptions{Include: FSResolver(testFS)}, concurrency)
+		el, ok := err.(ErrorList)
+		if !ok || len(el) != 2 {
+			t.Fatalf("Unexpected error \"%v\"", err)
+		}
+		if pe, ok := el[0].(*ParseError); !ok || pe.ErrorLocation.Filename != "conf/broken.lsp" {
+			t.Errorf("Unexpected error \"%v\"", el[0])
+		}
+		if pe, ok := el[1].(*ParseError); !ok || pe.ID != ErrorUnexpectedClosingParenthesis {
+			t.Errorf("Unexpected error \"%v\"", el[1])
+		}
+		if len(results) != 2 {
+			t.Fatalf("Unexpected results %v", results)
+		}
+		a := results["conf/a.lsp"]
+		if len(a) != 2 || !IsSymbolID(a[1].ElementAt(0), st.GetSymbolID("base")) || a[1].Position().Filename != "conf/common/base.lsp" {
+			t.Errorf("Unexpected result %v", a)
+		}
+		b := results["conf/b.lsp"]
+		if len(b) != 1 || !IsSymbolID(b[0].ElementAt(1), st.GetSymbolID("b")) {
+			t.Errorf("Unexpected result %v", b)
+		}
+	}
+}
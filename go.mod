@@ -1,3 +1,3 @@
 module github.com/healthy-tiger/listparser
 
-go 1.13
\ No newline at end of file
+go 1.16
\ No newline at end of file
@@ -0,0 +1,111 @@
+package listparser
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const defaultIncludeDirective = "include"
+
+// IncludeResolver includeディレクティブのpathを解決して読み込む。
+// fromはincludeを書いたファイルの名前。返すnameは読み込んだファイルの名前で、
+// 読み込んだ要素の位置と循環の検出に使われる。srcは読み込み後に閉じられる。
+type IncludeResolver func(from string, path string) (name string, src io.ReadCloser, err error)
+
+// FileResolver pathが相対パスの場合はfromのあるディレクトリから解決して、ファイルを開く。
+func FileResolver(from string, path string) (string, io.ReadCloser, error) {
+	name := path
+	if !filepath.IsAbs(path) {
+		name = filepath.Join(filepath.Dir(from), path)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, f, nil
+}
+
+// FSResolver fsysからファイルを読み込むIncludeResolverを返す。
+// pathが"/"で始まらない場合はfromのあるディレクトリから解決する。
+func FSResolver(fsys fs.FS) IncludeResolver {
+	return func(from string, p string) (string, io.ReadCloser, error) {
+		name := strings.TrimPrefix(p, "/")
+		if !strings.HasPrefix(p, "/") {
+			name = path.Join(path.Dir(from), p)
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return "", nil, err
+		}
+		return name, f, nil
+	}
+}
+
+// includePath lstがincludeディレクティブならそのパスを返す。
+func includePath(lst *ListElement, st *SymbolTable, directive SymbolID) (string, bool, error) {
+	if lst.Len() == 0 || !IsSymbolID(lst.elements[0], directive) {
+		return "", false, nil
+	}
+	if lst.Len() == 2 {
+		if path, ok := lst.StringAt(1); ok {
+			return path, true, nil
+		}
+		// StringAsSymbolの場合はパスもシンボルになっている。
+		if id, ok := lst.SymbolAt(1); ok {
+			path, err := st.GetSymbolName(id)
+			return path, true, err
+		}
+	}
+	return "", true, newParseError(lst.pos.Filename, lst.pos.Line, lst.pos.Column, ErrorInvalidInclude, nil)
+}
+
+// expandIncludes listsに含まれるトップレベルのincludeディレクティブを展開する。
+// includingは展開中のファイル名の並びで、最後がlistsのファイル名になる。
+func expandIncludes(lists []*ListElement, including []string, st *SymbolTable, opts ParseOptions) ([]*ListElement, error) {
+	name := opts.IncludeDirective
+	if name == "" {
+		name = defaultIncludeDirective
+	}
+	directive := lookupSymbolID(st, name)
+	result := make([]*ListElement, 0, len(lists))
+	for _, lst := range lists {
+		path, ok, err := includePath(lst, st, directive)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			result = append(result, lst)
+			continue
+		}
+
+		pos := lst.pos
+		included, src, err := opts.Include(including[len(including)-1], path)
+		if err != nil {
+			return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorIncludeFailed, err)
+		}
+		for _, f := range including {
+			if f == included {
+				src.Close()
+				return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorIncludeCycle, errors.New(strings.Join(append(including, included), " -> ")))
+			}
+		}
+		sublists, err := parseLists(included, st, src, opts)
+		src.Close()
+		if err == io.EOF {
+			// 空のファイル
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sublists, err = expandIncludes(sublists, append(including[:len(including):len(including)], included), st, opts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sublists...)
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package listparser
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mapResolver(files map[string]string) IncludeResolver {
+	return func(from string, path string) (string, io.ReadCloser, error) {
+		src, ok := files[path]
+		if !ok {
+			return "", nil, os.ErrNotExist
+		}
+		return path, ioutil.NopCloser(strings.NewReader(src)), nil
+	}
+}
+
+func TestInclude1(t *testing.T) {
+	files := map[string]string{
+		"a.lsp":     "(a 1)\n(include \"b.lsp\")",
+		"b.lsp":     "\n  (b 2)",
+		"empty.lsp": "",
+	}
+	st := NewSymbolTable()
+	src := `(main 0)
+(include "a.lsp")
+(include "empty.lsp")
+(main 3)`
+	lists, err := ParseStringWithOptions("main.lsp", st, src, ParseOptions{NumericType: true, Include: mapResolver(files)})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	expected := []struct {
+		head string
+		pos  Position
+	}{
+		{"main", Position{"main.lsp", 1, 1}},
+		{"a", Position{"a.lsp", 1, 1}},
+		{"b", Position{"b.lsp", 2, 3}},
+		{"main", Position{"main.lsp", 4, 1}},
+	}
+	if len(lists) != len(expected) {
+		t.Fatalf("Unexpected number of lists %d", len(lists))
+	}
+	for i, e := range expected {
+		if !IsSymbolID(lists[i].ElementAt(0), st.GetSymbolID(e.head)) || lists[i].Position() != e.pos {
+			t.Errorf("Unexpected list at %v", lists[i].Position())
+		}
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	files := map[string]string{
+		"cycle1.lsp": `(include "cycle2.lsp")`,
+		"cycle2.lsp": `(include "cycle1.lsp")`,
+		"broken.lsp": "(a\n(b)",
+	}
+	tests := []struct {
+		src string
+		id  int
+		pos Position
+	}{
+		{`(include "cycle1.lsp")`, ErrorIncludeCycle, Position{"cycle2.lsp", 1, 1}},
+		{`(include "missing.lsp")`, ErrorIncludeFailed, Position{"main.lsp", 1, 1}},
+		{`(x) (include "broken.lsp")`, ErrorMissingClosingParenthesis, Position{"broken.lsp", 2, 4}},
+		{`(include 1)`, ErrorInvalidInclude, Position{"main.lsp", 1, 1}},
+	}
+	for _, test := range tests {
+		st := NewSymbolTable()
+		_, err := ParseStringWithOptions("main.lsp", st, test.src, ParseOptions{NumericType: true, Include: mapResolver(files)})
+		pe, ok := err.(*ParseError)
+		if !ok || pe.ID != test.id || pe.ErrorLocation != test.pos {
+			t.Errorf("Unexpected error \"%v\" for %s", err, test.src)
+		}
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listparser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf", "sub.lsp"), []byte("(sub)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewSymbolTable()
+	main := filepath.Join(dir, "main.lsp")
+	lists, err := ParseStringWithOptions(main, st, `(load "conf/sub.lsp")`, ParseOptions{Include: FileResolver, IncludeDirective: "load"})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if len(lists) != 1 || lists[0].Position().Filename != filepath.Join(dir, "conf", "sub.lsp") {
+		t.Errorf("Unexpected result %v", lists)
+	}
+}
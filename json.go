@@ -0,0 +1,482 @@
+package listparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONで表現するときに使う予約されたキー
+const (
+	jsonKeySymbol  = "$symbol"
+	jsonKeyString  = "$string"
+	jsonKeyList    = "$list"
+	jsonKeyBracket = "$bracket"
+	jsonKeyBytes   = "$bytes"
+	jsonKeyChar    = "$char"
+	jsonKeyTail    = "$tail"
+	jsonKeyTag     = "$tag"
+	jsonKeyPrefix  = "$"
+)
+
+// JSONの真偽値とnullに対応するシンボル名
+const (
+	jsonTrue  = "true"
+	jsonFalse = "false"
+	jsonNull  = "null"
+)
+
+// ErrorUnsupportedJSONValue JSONで表現できない値
+var ErrorUnsupportedJSONValue = errors.New("Unsupported JSON value")
+
+// JSONOptions 構文要素とJSONの対応を指定する。
+type JSONOptions struct {
+	// SymbolsAsStrings シンボルをJSONの文字列にする。
+	// この場合、文字列は{"$string": "..."}になる。
+	SymbolsAsStrings bool
+	// PlistsAsObjects プロパティリストとして読める丸カッコのリストをJSONのオブジェクトにする。
+	PlistsAsObjects bool
+}
+
+// JSONEncoder 構文要素をJSONとしてストリームに書き出す。
+//
+// 構文要素とJSONの対応は次の通り。
+//
+//	整数                  数値（小数点と指数を含まない）
+//	浮動小数点数          数値（必ず小数点か指数を含む）
+//	文字列                文字列
+//	シンボル              {"$symbol": "name"}
+//	バイト列              {"$bytes": "base64"}（標準のBase64）
+//	文字                  {"$char": "a"}
+//	(...)                 配列
+//	[...], {...}          {"$list": [...], "$bracket": "["}
+//	(a b . c)             {"$list": [a, b], "$tail": c}（カッコが丸カッコ以外なら"$bracket"も付く）
+//	#name(...)            {"$list": [...], "$tag": "name"}（同上）
+//
+// JSONOptionsで、シンボルを文字列に、プロパティリストをオブジェクトにすることもできる。
+// JSONから読み込む場合、true、false、nullはそれぞれ同じ名前のシンボルになる。
+type JSONEncoder struct {
+	w         *bufio.Writer
+	st        *SymbolTable
+	opts      JSONOptions
+	ancestors map[*ListElement]bool // 書き出している途中のリスト
+}
+
+// NewJSONEncoder wに書き出すJSONEncoderを作る。シンボル名はstから取得する。
+func NewJSONEncoder(w io.Writer, st *SymbolTable, opts JSONOptions) *JSONEncoder {
+	return &JSONEncoder{bufio.NewWriter(w), st, opts, make(map[*ListElement]bool)}
+}
+
+// Encode eをJSONにして改行を付けて書き出す。
+func (enc *JSONEncoder) Encode(e SyntaxElement) error {
+	if err := enc.encode(e); err != nil {
+		return err
+	}
+	enc.w.WriteByte('\n')
+	return enc.w.Flush()
+}
+
+func (enc *JSONEncoder) encode(e SyntaxElement) error {
+	switch v := e.(type) {
+	case *ListElement:
+		return enc.encodeList(v)
+	case *intElement:
+		enc.w.WriteString(strconv.FormatInt(v.value, 10))
+	case *floatElement:
+		if math.IsInf(v.value, 0) || math.IsNaN(v.value) {
+			return ErrorUnsupportedJSONValue
+		}
+		enc.w.WriteString(formatFloat(v.value))
+	case *stringElement:
+		if enc.opts.SymbolsAsStrings {
+			enc.encodeTagged(jsonKeyString, v.value)
+		} else {
+			writeJSONString(enc.w, v.value)
+		}
+	case *bytesElement:
+		enc.encodeTagged(jsonKeyBytes, base64.StdEncoding.EncodeToString(v.value))
+	case *charElement:
+		enc.encodeTagged(jsonKeyChar, string(v.value))
+	case *symbolIDElement:
+		name, err := enc.st.GetSymbolName(v.value)
+		if err != nil {
+			return err
+		}
+		if enc.opts.SymbolsAsStrings {
+			writeJSONString(enc.w, name)
+		} else {
+			enc.encodeTagged(jsonKeySymbol, name)
+		}
+	default:
+		return ErrorUnsupportedJSONValue
+	}
+	return nil
+}
+
+func (enc *JSONEncoder) encodeTagged(key string, value string) {
+	enc.w.WriteByte('{')
+	writeJSONString(enc.w, key)
+	enc.w.WriteByte(':')
+	writeJSONString(enc.w, value)
+	enc.w.WriteByte('}')
+}
+
+func (enc *JSONEncoder) encodeList(lst *ListElement) error {
+	// 循環したリストはJSONで表現できない。共有されているだけのリストは現れるたびに書き出す。
+	if enc.ancestors[lst] {
+		return ErrorUnsupportedJSONValue
+	}
+	enc.ancestors[lst] = true
+	defer delete(enc.ancestors, lst)
+	if enc.opts.PlistsAsObjects && lst.openchar == tokLeftParenthesis && lst.tail == nil && lst.tag == nil && lst.Len() > 0 {
+		if pl, err := lst.Plist(); err == nil && enc.isObjectKeys(pl) {
+			enc.w.WriteByte('{')
+			for i, entry := range pl.entries {
+				if i > 0 {
+					enc.w.WriteByte(',')
+				}
+				name, _ := enc.st.GetSymbolName(entry.Key)
+				writeJSONString(enc.w, name)
+				enc.w.WriteByte(':')
+				if err := enc.encode(entry.Value); err != nil {
+					return err
+				}
+			}
+			enc.w.WriteByte('}')
+			return nil
+		}
+	}
+
+	tagged := lst.openchar != tokLeftParenthesis || lst.tail != nil || lst.tag != nil
+	if tagged {
+		enc.w.WriteByte('{')
+		writeJSONString(enc.w, jsonKeyList)
+		enc.w.WriteByte(':')
+	}
+	enc.w.WriteByte('[')
+	for i, child := range lst.elements {
+		if i > 0 {
+			enc.w.WriteByte(',')
+		}
+		if err := enc.encode(child); err != nil {
+			return err
+		}
+	}
+	enc.w.WriteByte(']')
+	if lst.tail != nil {
+		enc.w.WriteByte(',')
+		writeJSONString(enc.w, jsonKeyTail)
+		enc.w.WriteByte(':')
+		if err := enc.encode(lst.tail); err != nil {
+			return err
+		}
+	}
+	if lst.tag != nil {
+		name, err := lst.tagName(enc.st)
+		if err != nil {
+			return err
+		}
+		enc.w.WriteByte(',')
+		writeJSONString(enc.w, jsonKeyTag)
+		enc.w.WriteByte(':')
+		writeJSONString(enc.w, name)
+	}
+	if lst.openchar != tokLeftParenthesis {
+		enc.w.WriteByte(',')
+		writeJSONString(enc.w, jsonKeyBracket)
+		enc.w.WriteByte(':')
+		writeJSONString(enc.w, string(lst.openchar))
+	}
+	if tagged {
+		enc.w.WriteByte('}')
+	}
+	return nil
+}
+
+// isObjectKeys plのキーが予約されたキーと区別できるか調べる。
+func (enc *JSONEncoder) isObjectKeys(pl *PropertyList) bool {
+	for _, entry := range pl.entries {
+		name, err := enc.st.GetSymbolName(entry.Key)
+		if err != nil || strings.HasPrefix(name, jsonKeyPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeJSONString sをJSONの文字列として書き出す。UTF-8として正しくないバイトはU+FFFDになる。
+func writeJSONString(w *bufio.Writer, s string) {
+	w.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			w.WriteByte('\\')
+			w.WriteRune(r)
+		case r == '\n':
+			w.WriteString(`\n`)
+		case r == '\r':
+			w.WriteString(`\r`)
+		case r == '\t':
+			w.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(w, `\u%04x`, r)
+		default:
+			w.WriteRune(r)
+		}
+	}
+	w.WriteByte('"')
+}
+
+// ToJSON eをJSONに変換する。
+func ToJSON(st *SymbolTable, e SyntaxElement, opts JSONOptions) ([]byte, error) {
+	var b bytes.Buffer
+	if err := NewJSONEncoder(&b, st, opts).Encode(e); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte{'\n'}), nil
+}
+
+type jsonDecoder struct {
+	dec      *json.Decoder
+	data     []byte
+	filename string
+	st       *SymbolTable
+	opts     JSONOptions
+}
+
+// FromJSON dataのJSONを構文要素に変換する。要素の位置はdataの中での位置になる。
+func FromJSON(filename string, st *SymbolTable, data []byte, opts JSONOptions) (SyntaxElement, error) {
+	d := &jsonDecoder{json.NewDecoder(bytes.NewReader(data)), data, filename, st, opts}
+	d.dec.UseNumber()
+	pos := d.position()
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, d.error(pos, err)
+	}
+	e, err := d.decode(tok, pos)
+	if err != nil {
+		return nil, err
+	}
+	pos = d.position()
+	if _, err := d.dec.Token(); err != io.EOF {
+		return nil, d.error(pos, ErrorUnsupportedJSONValue)
+	}
+	return e, nil
+}
+
+// position 次のトークンの位置を返す。
+func (d *jsonDecoder) position() Position {
+	offset := int(d.dec.InputOffset())
+	for offset < len(d.data) && strings.IndexByte(" \t\r\n,:", d.data[offset]) >= 0 {
+		offset++
+	}
+	line := 1 + bytes.Count(d.data[:offset], []byte{'\n'})
+	column := offset - bytes.LastIndexByte(d.data[:offset], '\n')
+	return Position{d.filename, line, column}
+}
+
+func (d *jsonDecoder) error(pos Position, err error) error {
+	return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidJSON, err)
+}
+
+func (d *jsonDecoder) next() (json.Token, Position, error) {
+	pos := d.position()
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, pos, d.error(pos, err)
+	}
+	return tok, pos, nil
+}
+
+func (d *jsonDecoder) decode(tok json.Token, pos Position) (SyntaxElement, error) {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '[' {
+			return d.decodeArray(tokLeftParenthesis, pos)
+		} else if v == '{' {
+			return d.decodeObject(pos)
+		}
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if n, err := v.Int64(); err == nil {
+				return &intElement{n, pos, ""}, nil
+			}
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, d.error(pos, err)
+		}
+		return &floatElement{f, pos, ""}, nil
+	case string:
+		if d.opts.SymbolsAsStrings {
+			return newSymbol(d.st, v, pos, "")
+		}
+		return &stringElement{v, pos, "", nil}, nil
+	case bool:
+		if v {
+			return newSymbol(d.st, jsonTrue, pos, "")
+		}
+		return newSymbol(d.st, jsonFalse, pos, "")
+	case nil:
+		return newSymbol(d.st, jsonNull, pos, "")
+	}
+	return nil, d.error(pos, ErrorUnsupportedJSONValue)
+}
+
+// decodeArray '['を読んだ後の配列の要素を読んでリストにする。
+func (d *jsonDecoder) decodeArray(openchar rune, pos Position) (*ListElement, error) {
+	lst := &ListElement{openchar: openchar, elements: make([]SyntaxElement, 0), pos: pos}
+	for d.dec.More() {
+		tok, epos, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		e, err := d.decode(tok, epos)
+		if err != nil {
+			return nil, err
+		}
+		lst.elements = append(lst.elements, e)
+	}
+	if _, _, err := d.next(); err != nil {
+		return nil, err
+	}
+	return lst, nil
+}
+
+// decodeObject '{'を読んだ後のオブジェクトを読む。
+// 予約されたキーを持つオブジェクトはシンボル、文字列、リストに、それ以外はプロパティリストになる。
+func (d *jsonDecoder) decodeObject(pos Position) (SyntaxElement, error) {
+	plist := &ListElement{openchar: tokLeftParenthesis, elements: make([]SyntaxElement, 0), pos: pos}
+	reserved := make(map[string]SyntaxElement)
+	for d.dec.More() {
+		tok, kpos, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		tok, vpos, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(key, jsonKeyPrefix) {
+			value, err := d.decode(tok, vpos)
+			if err != nil {
+				return nil, err
+			}
+			name, err := newSymbol(d.st, key, kpos, "")
+			if err != nil {
+				return nil, err
+			}
+			plist.elements = append(plist.elements, name, value)
+			continue
+		}
+
+		switch key {
+		case jsonKeyList:
+			if tok != json.Delim('[') {
+				return nil, d.error(vpos, ErrorUnsupportedJSONValue)
+			}
+			lst, err := d.decodeArray(tokLeftParenthesis, pos)
+			if err != nil {
+				return nil, err
+			}
+			reserved[key] = lst
+		case jsonKeyTail:
+			tail, err := d.decode(tok, vpos)
+			if err != nil {
+				return nil, err
+			}
+			reserved[key] = tail
+		case jsonKeySymbol, jsonKeyString, jsonKeyBracket, jsonKeyBytes, jsonKeyChar, jsonKeyTag:
+			s, ok := tok.(string)
+			if !ok {
+				return nil, d.error(vpos, ErrorUnsupportedJSONValue)
+			}
+			if key == jsonKeyTag && s == "" {
+				// 名前のないタグ
+				reserved[key] = &symbolIDElement{InvalidSymbolID, pos, ""}
+			} else if key == jsonKeySymbol || key == jsonKeyTag {
+				sym, err := newSymbol(d.st, s, pos, "")
+				if err != nil {
+					return nil, err
+				}
+				reserved[key] = sym
+			} else if key == jsonKeyChar {
+				r, size := utf8.DecodeRuneInString(s)
+				if size == 0 || size != len(s) || r == utf8.RuneError {
+					return nil, d.error(vpos, ErrorUnsupportedJSONValue)
+				}
+				reserved[key] = &charElement{r, pos, ""}
+			} else if key == jsonKeyBytes {
+				b, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, d.error(vpos, err)
+				}
+				reserved[key] = &bytesElement{b, pos, ""}
+			} else {
+				reserved[key] = &stringElement{s, pos, "", nil}
+			}
+		default:
+			return nil, d.error(kpos, ErrorUnsupportedJSONValue)
+		}
+	}
+	if _, _, err := d.next(); err != nil {
+		return nil, err
+	}
+	if len(reserved) == 0 {
+		return plist, nil
+	}
+	if len(plist.elements) > 0 {
+		return nil, d.error(pos, ErrorUnsupportedJSONValue)
+	}
+	return d.reservedElement(reserved, pos)
+}
+
+func (d *jsonDecoder) reservedElement(reserved map[string]SyntaxElement, pos Position) (SyntaxElement, error) {
+	if e, ok := reserved[jsonKeyList]; ok {
+		lst := e.(*ListElement)
+		n := 1
+		if b, ok := reserved[jsonKeyBracket]; ok {
+			s, _ := b.StringValue()
+			r, size := utf8.DecodeRuneInString(s)
+			if _, ok := closingBrackets[r]; !ok || size != len(s) {
+				return nil, d.error(pos, ErrorUnsupportedJSONValue)
+			}
+			lst.openchar = r
+			n++
+		}
+		if tag, ok := reserved[jsonKeyTag]; ok {
+			lst.tag = tag.(*symbolIDElement)
+			n++
+		}
+		if tail, ok := reserved[jsonKeyTail]; ok {
+			if lst.Len() == 0 {
+				return nil, d.error(pos, ErrorUnsupportedJSONValue)
+			}
+			lst.tail = tail
+			n++
+		}
+		if len(reserved) == n {
+			return lst, nil
+		}
+	} else if len(reserved) == 1 {
+		if e, ok := reserved[jsonKeySymbol]; ok {
+			return e, nil
+		} else if e, ok := reserved[jsonKeyString]; ok {
+			return e, nil
+		} else if e, ok := reserved[jsonKeyBytes]; ok {
+			return e, nil
+		} else if e, ok := reserved[jsonKeyChar]; ok {
+			return e, nil
+		}
+	}
+	return nil, d.error(pos, ErrorUnsupportedJSONValue)
+}
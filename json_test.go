@@ -0,0 +1,181 @@
+package listparser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestToJSON1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestToJSON1", st, `(server "a\n\"b\"" 80 1.0 [x {y}] (port 8080 host "h"))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	tests := []struct {
+		opts     JSONOptions
+		expected string
+	}{
+		{JSONOptions{}, `[{"$symbol":"server"},"a\n\"b\"",80,1.0,{"$list":[{"$symbol":"x"},{"$list":[{"$symbol":"y"}],"$bracket":"{"}],"$bracket":"["},[{"$symbol":"port"},8080,{"$symbol":"host"},"h"]]`},
+		{JSONOptions{SymbolsAsStrings: true, PlistsAsObjects: true}, `["server",{"$string":"a\n\"b\""},80,1.0,{"$list":["x",{"$list":["y"],"$bracket":"{"}],"$bracket":"["},{"port":8080,"host":{"$string":"h"}}]`},
+	}
+	for _, test := range tests {
+		data, err := ToJSON(st, lists[0], test.opts)
+		if err != nil {
+			t.Fatalf("JSON error with \"%v\"", err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("Unexpected JSON %s", data)
+		}
+		e, err := FromJSON("TestToJSON1.json", st, data, test.opts)
+		if err != nil {
+			t.Fatalf("JSON error with \"%v\"", err)
+		}
+		if !Equal(e, lists[0]) {
+			t.Errorf("Not equal after round trip %s", data)
+		}
+	}
+}
+
+func TestFromJSON1(t *testing.T) {
+	st := NewSymbolTable()
+	data := []byte(`{
+  "name": "x",
+  "ports": [80, 443.5],
+  "enabled": true,
+  "extra": null
+}`)
+	e, err := FromJSON("TestFromJSON1.json", st, data, JSONOptions{})
+	if err != nil {
+		t.Fatalf("JSON error with \"%v\"", err)
+	}
+	pl, err := e.(*ListElement).Plist()
+	if err != nil {
+		t.Fatalf("Plist error with \"%v\"", err)
+	}
+	if s, ok := pl.GetString(st.GetSymbolID("name")); !ok || s != "x" {
+		t.Error("Unexpected name")
+	}
+	ports, ok := pl.GetList(st.GetSymbolID("ports"))
+	if !ok || !IsInt(ports.ElementAt(0)) || !IsFloat(ports.ElementAt(1)) {
+		t.Error("Unexpected ports")
+	}
+	if ports.ElementAt(1).Position() != (Position{"TestFromJSON1.json", 3, 17}) {
+		t.Errorf("Unexpected position %v", ports.ElementAt(1).Position())
+	}
+	if v, ok := pl.GetSymbol(st.GetSymbolID("enabled")); !ok || v != st.GetSymbolID("true") {
+		t.Error("Unexpected enabled")
+	}
+	if v, ok := pl.GetSymbol(st.GetSymbolID("extra")); !ok || v != st.GetSymbolID("null") {
+		t.Error("Unexpected extra")
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	st := NewSymbolTable()
+	for _, data := range []string{`[1,`, `{"$unknown": 1}`, `{"$symbol": 1}`, `{"$list": [], "$bracket": "<"}`, `{"$symbol": "a", "b": 1}`, `[1] [2]`} {
+		_, err := FromJSON("TestFromJSONErrors.json", st, []byte(data), JSONOptions{})
+		if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorInvalidJSON {
+			t.Errorf("Unexpected error \"%v\" for %s", err, data)
+		}
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestJSONEncoder", st, "(a 1)\n(b 2)", true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	var b bytes.Buffer
+	enc := NewJSONEncoder(&b, st, JSONOptions{SymbolsAsStrings: true})
+	for _, lst := range lists {
+		if err := enc.Encode(lst); err != nil {
+			t.Fatalf("JSON error with \"%v\"", err)
+		}
+	}
+	if b.String() != "[\"a\",1]\n[\"b\",2]\n" {
+		t.Errorf("Unexpected JSON %s", b.String())
+	}
+}
+
+func TestJSONBytes(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestJSONBytes", st, `(#"\x00\xff")`, ParseOptions{ByteStrings: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	data, err := ToJSON(st, lists[0], JSONOptions{})
+	if err != nil || string(data) != `[{"$bytes":"AP8="}]` {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	e, err := FromJSON("TestJSONBytes", st, data, JSONOptions{})
+	if err != nil || !Equal(e, lists[0]) {
+		t.Errorf("Unexpected element with \"%v\"", err)
+	}
+}
+
+func TestJSONDottedPairs(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestJSONDottedPairs", st, `(a (b . 1) [c . d])`, ParseOptions{NumericType: true, DottedPairs: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	data, err := ToJSON(st, lists[0], JSONOptions{SymbolsAsStrings: true, PlistsAsObjects: true})
+	if err != nil || string(data) != `["a",{"$list":["b"],"$tail":1},{"$list":["c"],"$tail":"d","$bracket":"["}]` {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	e, err := FromJSON("TestJSONDottedPairs", st, data, JSONOptions{SymbolsAsStrings: true})
+	if err != nil || !Equal(e, lists[0]) {
+		t.Errorf("Unexpected element with \"%v\"", err)
+	}
+	if _, err := FromJSON("TestJSONDottedPairs", st, []byte(`{"$list":[],"$tail":1}`), JSONOptions{}); err == nil {
+		t.Error("Empty list with a tail was accepted")
+	}
+}
+
+func TestJSONCycles(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestJSONCycles", st, `(#0=(a) #0#) #0=(a #0#)`, ParseOptions{DatumLabels: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if data, err := ToJSON(st, lists[0], JSONOptions{SymbolsAsStrings: true}); err != nil || string(data) != `[["a"],["a"]]` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+	if _, err := ToJSON(st, lists[1], JSONOptions{}); err != ErrorUnsupportedJSONValue {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
+
+func TestJSONTaggedLists(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestJSONTaggedLists", st, `(#set(a) #[1])`, ParseOptions{NumericType: true, TaggedLists: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	data, err := ToJSON(st, lists[0], JSONOptions{SymbolsAsStrings: true})
+	if err != nil || string(data) != `[{"$list":["a"],"$tag":"set"},{"$list":[1],"$tag":"","$bracket":"["}]` {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	e, err := FromJSON("TestJSONTaggedLists", st, data, JSONOptions{SymbolsAsStrings: true})
+	if err != nil || !Equal(e, lists[0]) {
+		t.Errorf("Unexpected element with \"%v\"", err)
+	}
+}
+
+func TestFromJSONFrozenTable(t *testing.T) {
+	st := NewSymbolTableWithNames("a", "true")
+	st.Freeze()
+	if _, err := FromJSON("TestFromJSONFrozenTable.json", st, []byte(`{"a": true}`), JSONOptions{}); err != nil {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	for _, data := range []string{`{"b": 1}`, `[false]`, `[null]`, `{"$symbol": "b"}`, `{"$tag": "b", "$list": []}`} {
+		_, err := FromJSON("TestFromJSONFrozenTable.json", st, []byte(data), JSONOptions{})
+		if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorUnknownSymbol {
+			t.Errorf("Unexpected error \"%v\" for %s", err, data)
+		}
+	}
+	if _, err := FromJSON("TestFromJSONFrozenTable.json", st, []byte(`["b"]`), JSONOptions{SymbolsAsStrings: true}); err == nil {
+		t.Error("No error for unknown symbol as string")
+	}
+}
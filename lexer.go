@@ -2,9 +2,12 @@ package listparser
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
+	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -14,23 +17,66 @@ var (
 	ErrorUnexpectedEndOfLine      = errors.New("Unexpected end of line")
 	ErrorIllegalCharacterEncoding = errors.New("Illegal character encoding")
 	ErrorIllegalEscapeSequence    = errors.New("Illegal escape sequence '%c'")
+	ErrorInvalidCodePoint         = errors.New("Invalid code point")
+	ErrorSurrogateCodePoint       = errors.New("Surrogate code point")
+	ErrorUnterminatedRawString    = errors.New("Unterminated raw string")
+	ErrorInvalidTextBlock         = errors.New("Invalid text block delimiter")
+	ErrorUnterminatedTextBlock    = errors.New("Unterminated text block")
+	ErrorInvalidCharacterLiteral  = errors.New("Invalid character literal")
+	ErrorInvalidDatumLabel        = errors.New("Invalid datum label")
 )
 
 const (
-	ctxString    = iota
-	ctxEscSeq    = iota
-	ctxEscOctet1 = iota
-	ctxEscOctet2 = iota
-	ctxEscHex    = iota
-	ctxEscHex1   = iota
+	ctxString          = iota
+	ctxEscSeq          = iota
+	ctxEscOctet1       = iota
+	ctxEscOctet2       = iota
+	ctxEscHex          = iota
+	ctxEscHex1         = iota
+	ctxEscUnicode4     = iota
+	ctxEscUnicode8     = iota
+	ctxEscUnicodeBrace = iota
 )
 
 const (
 	backslash   = '\\'
 	doublequote = '"'
 	semicolon   = ';'
+	numbersign  = '#'
+	symbolQuote = '|'
 )
 
+// '#'に続けて生文字列リテラルを表す文字
+const rawStringPrefix = 'r'
+
+// '#'に続けてテキストブロックを表す文字列
+const textBlockPrefix = "<<"
+
+// '#'に続けて文字リテラルを表す文字と、コードポイントで書く文字リテラルの接頭辞
+const (
+	charLiteralPrefix = backslash
+	charHexPrefix     = 'x'
+)
+
+// '#'と数字に続けてデータラベルの定義と参照を表す文字
+const (
+	datumLabelDefine    = '='
+	datumLabelReference = numbersign
+)
+
+// 名前で書く文字リテラル
+var charNames = map[string]rune{
+	"nul":       '\x00',
+	"alarm":     '\x07',
+	"backspace": '\x08',
+	"tab":       '\x09',
+	"newline":   '\x0a',
+	"return":    '\x0d',
+	"escape":    '\x1b',
+	"space":     ' ',
+	"delete":    '\x7f',
+}
+
 const (
 	tokTab                = '\t'
 	tokSpace              = ' '
@@ -40,6 +86,10 @@ const (
 	tokRightSquareBracket = ']'
 	tokLeftCurlyBracket   = '{'
 	tokRightCurlyBracket  = '}'
+	tokQuote              = '\''
+	tokQuasiquote         = '`'
+	tokUnquote            = ','
+	unquoteSplicingSuffix = '@'
 )
 
 var stdEscSeq = map[rune]rune{
@@ -67,12 +117,22 @@ var hexValues = map[rune]int32{
 }
 
 type slexer struct {
-	inputname   string
-	linescanner *bufio.Scanner
-	reader      io.RuneScanner
-	lasttext    string
-	line        int
-	column      int
+	inputname     string
+	linescanner   *bufio.Scanner
+	reader        io.RuneScanner
+	lasttext      string
+	lastraw       string // 最後に読み込んだトークンの元の綴り
+	line          int
+	column        int
+	readerMacros  bool // ' ` , ,@ をリーダーマクロとして扱う。
+	byteStrings   bool // #"..."をバイト列リテラルとして扱う。
+	rawStrings    bool // #r"..."を生文字列リテラルとして扱う。
+	textBlocks    bool // #<<TAGをテキストブロックとして扱う。
+	charLiterals  bool // #\aを文字リテラルとして扱う。
+	quotedSymbols bool // |...|をシンボルとして扱う。
+	datumLabels   bool // #N=と#N#をデータラベルとして扱う。
+	taggedLists   bool // #name(...)をタグ付きのリストとして扱う。
+	lastblock     *textBlock
 }
 
 func (ss *slexer) nextline() error {
@@ -90,30 +150,44 @@ func (ss *slexer) nextline() error {
 }
 
 // readString 文字列リテラルの最初の'"'以降の部分をエスケープシーケンスを解釈して文字列を返す。
-func (ss *slexer) readString() (string, int, error) {
-	runes := make([]rune, 0)
+// \xHHと8進数のエスケープシーケンスは1バイトを、\uXXXX、\U00XXXXXX、\u{X...}はコードポイントのUTF-8表現を表す。
+// 二番目の返り値は前後の'"'を含む文字列リテラルの元の綴り。
+func (ss *slexer) readString() (string, string, int, error) {
+	return ss.readQuoted(doublequote)
+}
+
+// readQuoted quoteで囲まれた部分の最初のquote以降をreadStringと同じように読み込む。\quoteはquoteを表す。
+func (ss *slexer) readQuoted(quote rune) (string, string, int, error) {
+	var buf bytes.Buffer
+	raw := []rune{quote}
 	stat := ctxString
 	nr := 0
 	var oct int32
 	var hex int32
+	var code rune
+	ndigits := 0
 	r, sz, err := ss.reader.ReadRune()
 	for r != utf8.RuneError && err == nil {
 		nr++
+		raw = append(raw, r)
 		switch stat {
 		case ctxString:
 			if r == backslash {
 				stat = ctxEscSeq
-			} else if r == doublequote {
-				return string(runes), nr, nil
+			} else if r == quote {
+				return buf.String(), string(raw), nr, nil
 			} else {
-				runes = append(runes, r)
+				buf.WriteRune(r)
 			}
 
 		case ctxEscSeq:
 			ec, ok := stdEscSeq[r]
-			if ok {
+			if r == quote {
 				stat = ctxString
-				runes = append(runes, ec)
+				buf.WriteRune(r)
+			} else if ok {
+				stat = ctxString
+				buf.WriteRune(ec)
 			} else {
 				ov, ok := octValues[r]
 				if ok {
@@ -121,8 +195,14 @@ func (ss *slexer) readString() (string, int, error) {
 					oct = ov
 				} else if r == 'x' {
 					stat = ctxEscHex
+				} else if r == 'u' {
+					stat = ctxEscUnicode4
+					code, ndigits = 0, 0
+				} else if r == 'U' {
+					stat = ctxEscUnicode8
+					code, ndigits = 0, 0
 				} else {
-					return "", nr, ErrorIllegalEscapeSequence
+					return "", "", nr, ErrorIllegalEscapeSequence
 				}
 			}
 
@@ -132,17 +212,17 @@ func (ss *slexer) readString() (string, int, error) {
 				stat = ctxEscOctet2
 				oct = oct*8 + ov
 			} else {
-				return "", nr, ErrorIllegalEscapeSequence
+				return "", "", nr, ErrorIllegalEscapeSequence
 			}
 
 		case ctxEscOctet2:
 			ov, ok := octValues[r]
-			if ok {
+			if ok && oct*8+ov <= 0xff {
 				stat = ctxString
 				oct = oct*8 + ov
-				runes = append(runes, oct)
+				buf.WriteByte(byte(oct))
 			} else {
-				return "", nr, ErrorIllegalEscapeSequence
+				return "", "", nr, ErrorIllegalEscapeSequence
 			}
 
 		case ctxEscHex:
@@ -151,7 +231,7 @@ func (ss *slexer) readString() (string, int, error) {
 				stat = ctxEscHex1
 				hex = hv
 			} else {
-				return "", nr, ErrorIllegalEscapeSequence
+				return "", "", nr, ErrorIllegalEscapeSequence
 			}
 
 		case ctxEscHex1:
@@ -159,18 +239,66 @@ func (ss *slexer) readString() (string, int, error) {
 			if ok {
 				stat = ctxString
 				hex = hex*16 + hv
-				runes = append(runes, hex)
+				buf.WriteByte(byte(hex))
 			} else {
-				return "", nr, ErrorIllegalEscapeSequence
+				return "", "", nr, ErrorIllegalEscapeSequence
 			}
+
+		case ctxEscUnicode4, ctxEscUnicode8:
+			if r == '{' && stat == ctxEscUnicode4 && ndigits == 0 {
+				stat = ctxEscUnicodeBrace
+				break
+			}
+			hv, ok := hexValues[r]
+			if !ok {
+				return "", "", nr, ErrorIllegalEscapeSequence
+			}
+			code = code*16 + hv
+			ndigits++
+			if (stat == ctxEscUnicode4 && ndigits == 4) || (stat == ctxEscUnicode8 && ndigits == 8) {
+				if err := writeCodePoint(&buf, code); err != nil {
+					return "", "", nr, err
+				}
+				stat = ctxString
+			}
+
+		case ctxEscUnicodeBrace:
+			if r == '}' && ndigits > 0 {
+				if err := writeCodePoint(&buf, code); err != nil {
+					return "", "", nr, err
+				}
+				stat = ctxString
+				break
+			}
+			hv, ok := hexValues[r]
+			if !ok {
+				return "", "", nr, ErrorIllegalEscapeSequence
+			}
+			if ndigits == 6 {
+				return "", "", nr, ErrorInvalidCodePoint
+			}
+			code = code*16 + hv
+			ndigits++
 		}
 		r, sz, err = ss.reader.ReadRune()
 	}
 	if sz == 0 || err == io.EOF {
-		return "", nr, ErrorUnexpectedEndOfLine
+		return "", "", nr, ErrorUnexpectedEndOfLine
 	}
 	// 行単位で処理しているので行末以外は符号化のエラーとしていいはず。
-	return "", nr, ErrorIllegalCharacterEncoding
+	return "", "", nr, ErrorIllegalCharacterEncoding
+}
+
+// writeCodePoint コードポイントcodeをUTF-8でbufに書き込む。サロゲートと範囲外のコードポイントはエラーにする。
+func writeCodePoint(buf *bytes.Buffer, code rune) error {
+	if code >= 0xd800 && code <= 0xdfff {
+		return ErrorSurrogateCodePoint
+	}
+	if code < 0 || code > unicode.MaxRune {
+		return ErrorInvalidCodePoint
+	}
+	buf.WriteRune(code)
+	return nil
 }
 
 func (ss *slexer) readSymbol() (string, int, error) {
@@ -190,6 +318,18 @@ func (ss *slexer) readSymbol() (string, int, error) {
 			nr--
 			return string(rs), nr, nil
 
+		case tokQuote, tokQuasiquote, tokUnquote:
+			// リーダーマクロが有効な場合はシンボルの区切りになる。
+			if ss.readerMacros {
+				err = ss.reader.UnreadRune()
+				if err != nil {
+					return "", nr, err
+				}
+				nr--
+				return string(rs), nr, nil
+			}
+			rs = append(rs, r)
+
 		default:
 			rs = append(rs, r)
 		}
@@ -222,7 +362,7 @@ func (ss *slexer) readComment() (string, int, error) {
 }
 
 func newLexer(inputname string, reader io.Reader) (*slexer, error) {
-	ss := &slexer{inputname, bufio.NewScanner(reader), nil, "", 0, 0}
+	ss := &slexer{inputname: inputname, linescanner: bufio.NewScanner(reader)}
 	err := ss.nextline()
 	if err != nil {
 		return nil, err
@@ -231,14 +371,22 @@ func newLexer(inputname string, reader io.Reader) (*slexer, error) {
 }
 
 const (
-	symbol        = -(iota + 1)
-	stringLiteral = -(iota + 1)
-	commentText   = -(iota + 1)
+	symbol          = -(iota + 1)
+	stringLiteral   = -(iota + 1)
+	commentText     = -(iota + 1)
+	unquoteSplicing = -(iota + 1)
+	byteString      = -(iota + 1)
+	charLiteral     = -(iota + 1)
+	quotedSymbol    = -(iota + 1)
+	datumLabel      = -(iota + 1)
+	datumReference  = -(iota + 1)
+	listTag         = -(iota + 1)
 )
 
 // scan 次のトークンを読み込む
 // 読み込んだ文字またはトークンの種類、行番号、列番号、エラー（ある場合は）を返す。
 func (ss *slexer) scan() (rune, int, int, error) {
+	ss.lastblock = nil
 	// 現在の行の次の一文字を読み込む
 	r, sz, err := ss.reader.ReadRune()
 
@@ -263,14 +411,51 @@ func (ss *slexer) scan() (rune, int, int, error) {
 		ss.column = ss.column + 1
 		return r, ss.line, c, nil
 	case doublequote:
-		sl, nr, err := ss.readString()
+		sl, raw, nr, err := ss.readString()
 		c := ss.column
 		ss.column = ss.column + 1 + nr // '"'の分はss.readString()の返り値には含まれないので+1
 		if err == nil {
 			ss.lasttext = sl
+			ss.lastraw = raw
 			return stringLiteral, ss.line, c, nil
 		}
 		return 0, ss.line, c, err
+	case tokQuote, tokQuasiquote, tokUnquote:
+		if !ss.readerMacros {
+			return ss.scanSymbol()
+		}
+		c := ss.column
+		ss.column = ss.column + 1
+		if r == tokUnquote {
+			// ",@"の場合は二文字で一つのトークンになる。
+			r2, sz, err := ss.reader.ReadRune()
+			if err == nil && sz > 0 && r2 == unquoteSplicingSuffix {
+				ss.column = ss.column + 1
+				return unquoteSplicing, ss.line, c, nil
+			}
+			if err == nil {
+				err = ss.reader.UnreadRune()
+				if err != nil {
+					return 0, ss.line, c, ErrorIllegalLexerState
+				}
+			}
+		}
+		return r, ss.line, c, nil
+	case numbersign:
+		return ss.scanDispatch()
+	case symbolQuote:
+		if !ss.quotedSymbols {
+			return ss.scanSymbol()
+		}
+		sl, raw, nr, err := ss.readQuoted(symbolQuote)
+		c := ss.column
+		ss.column = ss.column + 1 + nr
+		if err == nil {
+			ss.lasttext = sl
+			ss.lastraw = raw
+			return quotedSymbol, ss.line, c, nil
+		}
+		return 0, ss.line, c, err
 	case semicolon:
 		cm, _, err := ss.readComment()
 		if err == nil {
@@ -279,21 +464,325 @@ func (ss *slexer) scan() (rune, int, int, error) {
 		}
 		return 0, ss.line, ss.column, err
 	default:
+		return ss.scanSymbol()
+	}
+}
+
+// scanDispatch '#'に続く文字によってトークンを読み込む。有効な記法でない場合は'#'で始まるシンボルにする。
+func (ss *slexer) scanDispatch() (rune, int, int, error) {
+	c := ss.column
+	r, sz, err := ss.reader.ReadRune()
+	if err == nil && sz > 0 {
+		switch {
+		case r == doublequote && ss.byteStrings:
+			sl, raw, nr, err := ss.readString()
+			ss.column = ss.column + 2 + nr // '#'と'"'の分を足す。
+			if err != nil {
+				return 0, ss.line, c, err
+			}
+			ss.lasttext = sl
+			ss.lastraw = string(numbersign) + raw
+			return byteString, ss.line, c, nil
+		case r == rawStringPrefix && ss.rawStrings:
+			return ss.scanRawString(c)
+		case r == rune(textBlockPrefix[0]) && ss.textBlocks:
+			return ss.scanTextBlock(c)
+		case r == charLiteralPrefix && ss.charLiterals:
+			return ss.scanCharLiteral(c)
+		case '0' <= r && r <= '9' && ss.datumLabels:
+			return ss.scanDatumLabel(c, r)
+		}
 		err = ss.reader.UnreadRune()
 		if err != nil {
-			return 0, ss.line, ss.column, ErrorIllegalLexerState
-		}
-		sl, nr, err := ss.readSymbol()
-		c := ss.column
-		ss.column = ss.column + nr
-		if err == nil {
-			ss.lasttext = sl
-			return symbol, ss.line, c, nil
+			return 0, ss.line, c, ErrorIllegalLexerState
 		}
+	}
+	return ss.scanPrefixedSymbol(string(numbersign), c)
+}
+
+// scanPrefixedSymbol 読み込み済みのprefixに続くシンボルを読み込む。cはprefixの先頭の列番号。
+// prefixは'#'で始まり、タグ付きのリストが有効で直後が開くカッコの場合は'#'を除いた名前をタグとして返す。
+func (ss *slexer) scanPrefixedSymbol(prefix string, c int) (rune, int, int, error) {
+	sl, nr, err := ss.readSymbol()
+	ss.column = c + utf8.RuneCountInString(prefix) + nr
+	if err != nil {
 		return 0, ss.line, c, err
 	}
+	ss.lasttext = prefix + sl
+	ss.lastraw = ss.lasttext
+	if ss.taggedLists {
+		r, sz, err := ss.reader.ReadRune()
+		if err == nil && sz > 0 {
+			if err := ss.reader.UnreadRune(); err != nil {
+				return 0, ss.line, c, ErrorIllegalLexerState
+			}
+			if r == tokLeftParenthesis || r == tokLeftSquareBracket || r == tokLeftCurlyBracket {
+				ss.lasttext = ss.lasttext[1:]
+				return listTag, ss.line, c, nil
+			}
+		}
+	}
+	return symbol, ss.line, c, nil
+}
+
+// scanRawString "#r"に続く0個以上の'#'と'"'を読み込み、生文字列リテラルを読み込む。
+// '"'が続かない場合は"#r"で始まるシンボルにする。cは'#'の列番号。
+func (ss *slexer) scanRawString(c int) (rune, int, int, error) {
+	line := ss.line
+	prefix := string([]rune{numbersign, rawStringPrefix})
+	for {
+		r, sz, err := ss.reader.ReadRune()
+		if err != nil || sz == 0 {
+			return ss.scanPrefixedSymbol(prefix, c)
+		}
+		if r == doublequote {
+			break
+		}
+		if r != numbersign {
+			err = ss.reader.UnreadRune()
+			if err != nil {
+				return 0, ss.line, c, ErrorIllegalLexerState
+			}
+			return ss.scanPrefixedSymbol(prefix, c)
+		}
+		prefix += string(numbersign)
+	}
+	ss.column = c + len(prefix) + 1
+	closing := string(doublequote) + prefix[2:]
+	sl, err := ss.readRawString(closing)
+	if err != nil {
+		return 0, line, c, err
+	}
+	ss.lasttext = sl
+	ss.lastraw = prefix + string(doublequote) + sl + closing
+	return stringLiteral, line, c, nil
+}
+
+// readRawString closingまでの部分をエスケープシーケンスを解釈せずに返す。
+// 行をまたぐ場合は行末を"\n"にする。
+func (ss *slexer) readRawString(closing string) (string, error) {
+	var b strings.Builder
+	for {
+		r, sz, err := ss.reader.ReadRune()
+		if sz == 0 || err == io.EOF {
+			if ss.nextline() != nil {
+				return "", ErrorUnterminatedRawString
+			}
+			b.WriteByte('\n')
+			continue
+		}
+		if r == utf8.RuneError || err != nil {
+			return "", ErrorIllegalCharacterEncoding
+		}
+		ss.column = ss.column + 1
+		b.WriteRune(r)
+		if strings.HasSuffix(b.String(), closing) {
+			return strings.TrimSuffix(b.String(), closing), nil
+		}
+	}
+}
+
+// scanTextBlock "#<"に続く'<'とTAGを読み込み、TAGだけを書いた行までをテキストブロックとして読み込む。
+// "#<<"で始まらない場合は"#<"で始まるシンボルにする。cは'#'の列番号。
+func (ss *slexer) scanTextBlock(c int) (rune, int, int, error) {
+	line := ss.line
+	prefix := textBlockPrefix[:1]
+	r, sz, err := ss.reader.ReadRune()
+	if err != nil || sz == 0 {
+		return ss.scanPrefixedSymbol(string(numbersign)+prefix, c)
+	}
+	if r != rune(textBlockPrefix[1]) {
+		err = ss.reader.UnreadRune()
+		if err != nil {
+			return 0, ss.line, c, ErrorIllegalLexerState
+		}
+		return ss.scanPrefixedSymbol(string(numbersign)+prefix, c)
+	}
+	rest, _, err := ss.readComment()
+	if err != nil {
+		return 0, line, c, err
+	}
+	tag := strings.TrimSpace(rest)
+	if tag == "" || strings.ContainsAny(tag, " \t") {
+		return 0, line, c, ErrorInvalidTextBlock
+	}
+
+	lines := make([]string, 0)
+	raw := []string{string(numbersign) + textBlockPrefix + rest}
+	for {
+		if ss.nextline() != nil {
+			return 0, line, c, ErrorUnterminatedTextBlock
+		}
+		text := ss.linescanner.Text()
+		if !utf8.ValidString(text) {
+			return 0, ss.line, ss.column, ErrorIllegalCharacterEncoding
+		}
+		body := strings.TrimLeft(text, " \t")
+		if isClosingTag(body, tag) {
+			end := len(text) - len(body) + len(tag)
+			raw = append(raw, text[:end])
+			ss.reader = strings.NewReader(text[end:])
+			ss.column = 1 + utf8.RuneCountInString(text[:end])
+			ss.lasttext, ss.lastblock = stripIndent(lines, len(text)-len(body), Position{ss.inputname, line + 1, 1}, Position{ss.inputname, ss.line, len(text) - len(body) + 1})
+			ss.lastraw = strings.Join(raw, "\n")
+			return stringLiteral, line, c, nil
+		}
+		lines = append(lines, text)
+		raw = append(raw, text)
+	}
+}
+
+// isClosingTag sがtagだけの行(末尾の空白は除く)か、tagの直後に閉じるカッコが続く行であるか調べる。
+// "END of story"のようにtagの後に他の文字が続く行はテキストブロックの内容とする。
+func isClosingTag(s, tag string) bool {
+	if !strings.HasPrefix(s, tag) {
+		return false
+	}
+	rest := s[len(tag):]
+	if strings.TrimRight(rest, " \t") == "" {
+		return true
+	}
+	switch rest[0] {
+	case tokRightParenthesis, tokRightSquareBracket, tokRightCurlyBracket:
+		return true
+	}
+	return false
+}
+
+// stripIndent 空白だけの行を除いた行とTAGの字下げindentに共通する先頭の空白と、各行の末尾の空白を取り除いて、
+// 改行で終わる行を並べた文字列を返す。firstは最初の行、closeは閉じるTAGの位置。
+func stripIndent(lines []string, indent int, first Position, close Position) (string, *textBlock) {
+	for _, text := range lines {
+		body := strings.TrimLeft(text, " \t")
+		if body != "" && len(text)-len(body) < indent {
+			indent = len(text) - len(body)
+		}
+	}
+	if len(lines) == 0 {
+		return "", &textBlock{close, close}
+	}
+	var b strings.Builder
+	for _, text := range lines {
+		text = strings.TrimRight(text, " \t")
+		if len(text) > indent {
+			b.WriteString(text[indent:])
+		}
+		b.WriteByte('\n')
+	}
+	first.Column = indent + 1
+	last := Position{first.Filename, first.Line + len(lines) - 1, indent + 1}
+	return b.String(), &textBlock{first, last}
+}
+
+// scanCharLiteral "#\"に続く文字リテラルを読み込む。cは'#'の列番号。
+//
+// 文字リテラルは#\aのような一文字か、#\spaceのような文字の名前か、#\x3042のような16進数のコードポイントで書く。
+// 一文字目がカッコや空白の場合はその文字だけを読み込む。
+func (ss *slexer) scanCharLiteral(c int) (rune, int, int, error) {
+	r, sz, err := ss.reader.ReadRune()
+	if err != nil || sz == 0 {
+		return 0, ss.line, c, ErrorInvalidCharacterLiteral
+	}
+	if r == utf8.RuneError {
+		return 0, ss.line, c, ErrorIllegalCharacterEncoding
+	}
+	name := string(r)
+	nr := 1
+	switch r {
+	case tokTab, tokSpace, semicolon, tokLeftParenthesis, tokLeftSquareBracket, tokLeftCurlyBracket, tokRightParenthesis, tokRightSquareBracket, tokRightCurlyBracket:
+	default:
+		rest, n, err := ss.readSymbol()
+		if err != nil {
+			return 0, ss.line, c, err
+		}
+		name += rest
+		nr += n
+	}
+	ss.column = c + 2 + nr // '#'と'\\'の分を足す。
+	ss.lastraw = string([]rune{numbersign, charLiteralPrefix}) + name
+	if nr == 1 {
+		ss.lasttext = name
+		return charLiteral, ss.line, c, nil
+	}
+	if v, ok := charNames[name]; ok {
+		ss.lasttext = string(v)
+		return charLiteral, ss.line, c, nil
+	}
+	if name[0] == charHexPrefix && len(name) <= 7 {
+		var code rune
+		for _, h := range name[1:] {
+			hv, ok := hexValues[h]
+			if !ok {
+				return 0, ss.line, c, ErrorInvalidCharacterLiteral
+			}
+			code = code*16 + hv
+		}
+		var b bytes.Buffer
+		if err := writeCodePoint(&b, code); err != nil {
+			return 0, ss.line, c, err
+		}
+		ss.lasttext = b.String()
+		return charLiteral, ss.line, c, nil
+	}
+	return 0, ss.line, c, ErrorInvalidCharacterLiteral
+}
+
+// scanDatumLabel '#'に続く数字dから#N=か#N#を読み込み、Nをトークンの文字列にする。
+// 数字の後ろが'='でも'#'でもない場合は'#'で始まるシンボルにする。cは'#'の列番号。
+func (ss *slexer) scanDatumLabel(c int, d rune) (rune, int, int, error) {
+	digits := []rune{d}
+	r, sz, err := ss.reader.ReadRune()
+	for err == nil && sz > 0 && '0' <= r && r <= '9' {
+		digits = append(digits, r)
+		r, sz, err = ss.reader.ReadRune()
+	}
+	if err == nil && sz > 0 && (r == datumLabelDefine || r == datumLabelReference) {
+		if _, err := strconv.ParseInt(string(digits), 10, 32); err != nil {
+			return 0, ss.line, c, ErrorInvalidDatumLabel
+		}
+		ss.column = c + 2 + len(digits) // '#'と最後の一文字の分を足す。
+		ss.lasttext = string(digits)
+		ss.lastraw = string(numbersign) + ss.lasttext + string(r)
+		if r == datumLabelDefine {
+			return datumLabel, ss.line, c, nil
+		}
+		return datumReference, ss.line, c, nil
+	}
+	if err == nil && sz > 0 {
+		if err := ss.reader.UnreadRune(); err != nil {
+			return 0, ss.line, c, ErrorIllegalLexerState
+		}
+	}
+	return ss.scanPrefixedSymbol(string(numbersign)+string(digits), c)
+}
+
+// scanSymbol 読み込んだ一文字を戻してからシンボルを読み込む。
+func (ss *slexer) scanSymbol() (rune, int, int, error) {
+	err := ss.reader.UnreadRune()
+	if err != nil {
+		return 0, ss.line, ss.column, ErrorIllegalLexerState
+	}
+	sl, nr, err := ss.readSymbol()
+	c := ss.column
+	ss.column = ss.column + nr
+	if err == nil {
+		ss.lasttext = sl
+		ss.lastraw = sl
+		return symbol, ss.line, c, nil
+	}
+	return 0, ss.line, c, err
 }
 
 func (ss *slexer) tokentext() string {
 	return ss.lasttext
 }
+
+// textBlock 最後に読み込んだ文字列リテラルがテキストブロックなら、その行の位置を返す。
+func (ss *slexer) textBlock() *textBlock {
+	return ss.lastblock
+}
+
+// rawtext 最後に読み込んだシンボルか文字列リテラルの元の綴りを返す。
+func (ss *slexer) rawtext() string {
+	return ss.lastraw
+}
@@ -79,3 +79,155 @@ func TestToken1(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+var macrosrc string = `('a ` + "`" + `(b ,c ,@d) e'f)`
+
+var macroresults []tokentest = []tokentest{
+	{tokLeftParenthesis, 1, 1, "", nil},
+	{tokQuote, 1, 2, "", nil},
+	{symbol, 1, 3, "a", nil},
+	{' ', 1, 4, "", nil},
+	{tokQuasiquote, 1, 5, "", nil},
+	{tokLeftParenthesis, 1, 6, "", nil},
+	{symbol, 1, 7, "b", nil},
+	{' ', 1, 8, "", nil},
+	{tokUnquote, 1, 9, "", nil},
+	{symbol, 1, 10, "c", nil},
+	{' ', 1, 11, "", nil},
+	{unquoteSplicing, 1, 12, "", nil},
+	{symbol, 1, 14, "d", nil},
+	{tokRightParenthesis, 1, 15, "", nil},
+	{' ', 1, 16, "", nil},
+	{symbol, 1, 17, "e", nil},
+	{tokQuote, 1, 18, "", nil},
+	{symbol, 1, 19, "f", nil},
+	{tokRightParenthesis, 1, 20, "", nil},
+}
+
+func TestTokenReaderMacros(t *testing.T) {
+	ss, err := newLexer("TestTokenReaderMacros", strings.NewReader(macrosrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.readerMacros = true
+
+	for i := 0; i < len(macroresults); i++ {
+		e := macroresults[i]
+		r, line, col, err := ss.scan()
+		if r != e.r || line != e.line || col != e.col || err != e.err {
+			t.Errorf("unexpected token %d at %d:%d, expected %d at %d:%d", r, line, col, e.r, e.line, e.col)
+		}
+		if r == symbol && ss.tokentext() != e.text {
+			t.Errorf("unexpected token text \"%v\", expected \"%v\"", ss.tokentext(), e.text)
+		}
+	}
+	_, _, _, err = ss.scan()
+	if err != io.EOF {
+		t.Error(err)
+	}
+}
+
+func TestTokenStringEscapes(t *testing.T) {
+	tests := []struct {
+		src  string
+		text string
+		err  error
+	}{
+		{`"\xe3\x81\x82"`, "あ", nil},
+		{`"\343\201\202"`, "あ", nil},
+		{`"\xff"`, "\xff", nil},
+		{`"あ\U0001F600"`, "あ😀", nil},
+		{`"\u{41}\u{1f600}\u{10FFFF}"`, "A😀\U0010FFFF", nil},
+		{`"\u304"`, "", ErrorIllegalEscapeSequence},
+		{`"\u{}"`, "", ErrorIllegalEscapeSequence},
+		{`"\u{g}"`, "", ErrorIllegalEscapeSequence},
+		{`"\u{1000000}"`, "", ErrorInvalidCodePoint},
+		{`"\U00110000"`, "", ErrorInvalidCodePoint},
+		{`"\uD800"`, "", ErrorSurrogateCodePoint},
+		{`"\u{dfff}"`, "", ErrorSurrogateCodePoint},
+		{`"\400"`, "", ErrorIllegalEscapeSequence},
+	}
+	for _, test := range tests {
+		ss, err := newLexer("TestTokenStringEscapes", strings.NewReader(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, _, err := ss.scan()
+		if err != test.err || (err == nil && (r != stringLiteral || ss.tokentext() != test.text)) {
+			t.Errorf("Unexpected token %d %q with \"%v\" for %s", r, ss.tokentext(), err, test.src)
+		}
+	}
+}
+
+func TestTokenByteString(t *testing.T) {
+	ss, err := newLexer("TestTokenByteString", strings.NewReader(`#"\xffあ" #a #`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.byteStrings = true
+	expected := []tokentest{
+		{byteString, 1, 1, "\xffあ", nil},
+		{' ', 1, 9, "", nil},
+		{symbol, 1, 10, "#a", nil},
+		{' ', 1, 12, "", nil},
+		{symbol, 1, 13, "#", nil},
+	}
+	for _, e := range expected {
+		r, line, col, err := ss.scan()
+		if r != e.r || line != e.line || col != e.col || err != e.err {
+			t.Errorf("unexpected token %d at %d:%d, expected %d at %d:%d", r, line, col, e.r, e.line, e.col)
+		}
+		if (r == symbol || r == byteString) && ss.tokentext() != e.text {
+			t.Errorf("unexpected token text %q, expected %q", ss.tokentext(), e.text)
+		}
+	}
+	if ss.rawtext() != "#" {
+		t.Errorf("unexpected raw text %q", ss.rawtext())
+	}
+}
+
+func TestTokenRawString(t *testing.T) {
+	src := `#r"C:\dir\n" #r#"say "hi""# #r"a
+ b" x #rx #r#y #r`
+	ss, err := newLexer("TestTokenRawString", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.rawStrings = true
+	expected := []tokentest{
+		{stringLiteral, 1, 1, `C:\dir\n`, nil},
+		{' ', 1, 13, "", nil},
+		{stringLiteral, 1, 14, `say "hi"`, nil},
+		{' ', 1, 28, "", nil},
+		{stringLiteral, 1, 29, "a\n b", nil},
+		{' ', 2, 4, "", nil},
+		{symbol, 2, 5, "x", nil},
+		{' ', 2, 6, "", nil},
+		{symbol, 2, 7, "#rx", nil},
+		{' ', 2, 10, "", nil},
+		{symbol, 2, 11, "#r#y", nil},
+		{' ', 2, 15, "", nil},
+		{symbol, 2, 16, "#r", nil},
+	}
+	for _, e := range expected {
+		r, line, col, err := ss.scan()
+		if r != e.r || line != e.line || col != e.col || err != e.err {
+			t.Errorf("unexpected token %d at %d:%d, expected %d at %d:%d", r, line, col, e.r, e.line, e.col)
+		}
+		if (r == symbol || r == stringLiteral) && ss.tokentext() != e.text {
+			t.Errorf("unexpected token text %q, expected %q", ss.tokentext(), e.text)
+		}
+		if r == stringLiteral && e.col == 14 && ss.rawtext() != `#r#"say "hi""#` {
+			t.Errorf("unexpected raw text %q", ss.rawtext())
+		}
+	}
+
+	ss, err = newLexer("TestTokenRawString", strings.NewReader("#r#\"a\"\nb\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.rawStrings = true
+	if _, line, col, err := ss.scan(); err != ErrorUnterminatedRawString || line != 1 || col != 1 {
+		t.Errorf("unexpected error \"%v\" at %d:%d", err, line, col)
+	}
+}
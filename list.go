@@ -4,11 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
 )
 
 // ErrorInvalidSymbolID シンボルIDに対応するシンボルが定義されていない。
 var ErrorInvalidSymbolID = errors.New("Invalid symbol ID")
 
+// ErrorDuplicateSymbol 同じシンボル名が二回以上定義されている。
+var ErrorDuplicateSymbol = errors.New("Duplicate symbol")
+
 // InvalidSymbolID 無効なシンボルID(-1)
 const InvalidSymbolID = -1
 
@@ -16,34 +20,51 @@ const InvalidSymbolID = -1
 type SymbolID int
 
 // SymbolTable シンボルIDとシンボル名のマップ
+// 複数のゴルーチンから同時に使うことができる。
 type SymbolTable struct {
+	mu        sync.Mutex
 	symbolMap map[string]SymbolID
+	names     []string
+	frozen    bool
 }
 
 // NewSymbolTable 新しいSymbolTableを作る。
 func NewSymbolTable() *SymbolTable {
-	return &SymbolTable{make(map[string]SymbolID)}
+	return &SymbolTable{symbolMap: make(map[string]SymbolID), names: make([]string, 0)}
 }
 
 // GetSymbolID はシンボルnameに対するIDを返す。
 // IDが割り当てられていないシンボルに対しては、新たにIDを割り当てて返す。
+// ただし、Freezeされたテーブルでは新たにIDを割り当てずにInvalidSymbolIDを返す。
 func (st *SymbolTable) GetSymbolID(name string) SymbolID {
+	st.mu.Lock()
+	defer st.mu.Unlock()
 	n, ok := st.symbolMap[name]
 	if !ok {
-		n = SymbolID(len(st.symbolMap))
-		st.symbolMap[name] = SymbolID(n)
+		if st.frozen {
+			return InvalidSymbolID
+		}
+		n = st.add(name)
 	}
 	return n
 }
 
+// add nameに新しいIDを割り当てる。st.muをロックしてから呼ぶこと。
+func (st *SymbolTable) add(name string) SymbolID {
+	n := SymbolID(len(st.names))
+	st.symbolMap[name] = n
+	st.names = append(st.names, name)
+	return n
+}
+
 // GetSymbolName はシンボルのIDからシンボル名を取得する。
 func (st *SymbolTable) GetSymbolName(id SymbolID) (string, error) {
-	for k, v := range st.symbolMap {
-		if v == id {
-			return k, nil
-		}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if id < 0 || int(id) >= len(st.names) {
+		return "", ErrorInvalidSymbolID
 	}
-	return "", ErrorInvalidSymbolID
+	return st.names[id], nil
 }
 
 // SyntaxElement 構文要素を表す。
@@ -53,6 +74,23 @@ type SyntaxElement interface {
 	FloatValue() (float64, bool)
 	StringValue() (string, bool)
 	SymbolValue() (SymbolID, bool)
+	BytesValue() ([]byte, bool)
+	RuneValue() (rune, bool)
+}
+
+// rawer パースした要素がソースコード上の元の綴りを返す。
+// SyntaxElementを実装する型に求めないように、SyntaxElementとは別のインタフェースにしている。
+type rawer interface {
+	Raw() (string, bool)
+}
+
+// Raw eがパースした要素なら、ソースコード上の元の綴りを返す。
+// リスト、元の綴りを持たない要素、パッケージの外で実装された要素の場合はfalseを返す。
+func Raw(e SyntaxElement) (string, bool) {
+	if r, ok := e.(rawer); ok {
+		return r.Raw()
+	}
+	return "", false
 }
 
 // ListElement ListElementまたはValueを0個以上含む
@@ -60,6 +98,9 @@ type ListElement struct {
 	openchar rune
 	elements []SyntaxElement
 	pos      Position
+	macro    rune             // リーダーマクロから展開されたリストの場合はマクロの文字
+	tail     SyntaxElement    // ドット対(a b . c)の場合は"."の後ろの要素
+	tag      *symbolIDElement // #name(...)のようなタグ付きのリストの場合はタグ
 }
 
 const nilInt = 0
@@ -80,6 +121,35 @@ func (lst *ListElement) Len() int {
 	return len(lst.elements)
 }
 
+// Tail lstがドット対(a b . c)の場合は"."の後ろの要素を返す。真リストの場合はfalseを返す。
+// LenとElementAtは"."より前の要素だけを扱う。
+func (lst *ListElement) Tail() (SyntaxElement, bool) {
+	return lst.tail, lst.tail != nil
+}
+
+// Tag lstが#name(...)のようなタグ付きのリストの場合はタグのシンボルを返す。
+// #(...)のように名前のないタグの場合はInvalidSymbolIDとtrueを返す。タグが付いていない場合はfalseを返す。
+// #(...)と#[...]はBracketで区別する。
+func (lst *ListElement) Tag() (SymbolID, bool) {
+	if lst.tag == nil {
+		return InvalidSymbolID, false
+	}
+	return lst.tag.value, true
+}
+
+// Bracket lstの開くカッコ('('、'['または'{')を返す。
+func (lst *ListElement) Bracket() rune {
+	return lst.openchar
+}
+
+// tagName lstのタグの名前を返す。名前のないタグの場合は空の文字列を返す。
+func (lst *ListElement) tagName(st *SymbolTable) (string, error) {
+	if lst.tag.value == InvalidSymbolID {
+		return "", nil
+	}
+	return st.GetSymbolName(lst.tag.value)
+}
+
 // Position lstのソースコード上の位置を返す。
 func (lst *ListElement) Position() Position {
 	return lst.pos
@@ -105,6 +175,16 @@ func (lst *ListElement) SymbolValue() (SymbolID, bool) {
 	return InvalidSymbolID, false
 }
 
+// BytesValue lstはバイト列型の値を持たない。
+func (lst *ListElement) BytesValue() ([]byte, bool) {
+	return nil, false
+}
+
+// RuneValue lstは文字型の値を持たない。
+func (lst *ListElement) RuneValue() (rune, bool) {
+	return 0, false
+}
+
 // ElementAt lstのindex番目の要素を返す。
 func (lst *ListElement) ElementAt(index int) SyntaxElement {
 	if index < 0 || index >= len(lst.elements) {
@@ -149,16 +229,38 @@ func (lst *ListElement) SymbolAt(index int) (SymbolID, bool) {
 	return InvalidSymbolID, false
 }
 
+// BytesAt lstのindex番目の要素が[]byteならその値を返す。
+func (lst *ListElement) BytesAt(index int) ([]byte, bool) {
+	se := lst.ElementAt(index)
+	if se != nil {
+		return se.BytesValue()
+	}
+	return nil, false
+}
+
+// RuneAt lstのindex番目の要素がruneならその値を返す。
+func (lst *ListElement) RuneAt(index int) (rune, bool) {
+	se := lst.ElementAt(index)
+	if se != nil {
+		return se.RuneValue()
+	}
+	return 0, false
+}
+
 func newLiteral(value interface{}, filename string, line int, column int) (SyntaxElement, error) {
 	switch v := value.(type) {
 	case int64:
-		return &intElement{v, Position{filename, line, column}}, nil
+		return &intElement{v, Position{filename, line, column}, ""}, nil
 	case float64:
-		return &floatElement{v, Position{filename, line, column}}, nil
+		return &floatElement{v, Position{filename, line, column}, ""}, nil
 	case SymbolID:
-		return &symbolIDElement{v, Position{filename, line, column}}, nil
+		return &symbolIDElement{v, Position{filename, line, column}, ""}, nil
 	case string:
-		return &stringElement{v, Position{filename, line, column}}, nil
+		return &stringElement{v, Position{filename, line, column}, "", nil}, nil
+	case []byte:
+		return &bytesElement{v, Position{filename, line, column}, ""}, nil
+	case rune:
+		return &charElement{v, Position{filename, line, column}, ""}, nil
 	}
 	return nil, fmt.Errorf("Unexpected value type: %v", reflect.TypeOf(value))
 }
@@ -166,6 +268,7 @@ func newLiteral(value interface{}, filename string, line int, column int) (Synta
 type intElement struct {
 	value int64
 	pos   Position
+	raw   string // ソースコード上の元の綴り。パースせずに作った要素では空になる。
 }
 
 // Position eのソースコード上の位置を返す。
@@ -193,9 +296,25 @@ func (e *intElement) SymbolValue() (SymbolID, bool) {
 	return InvalidSymbolID, false
 }
 
+// BytesValue eがバイト列リテラルなら、バイト列リテラルの[]byteの値を返す。
+func (e *intElement) BytesValue() ([]byte, bool) {
+	return nil, false
+}
+
+// RuneValue eが文字リテラルなら、文字リテラルのruneの値を返す。
+func (e *intElement) RuneValue() (rune, bool) {
+	return 0, false
+}
+
+// Raw eのソースコード上の元の綴りを返す。パースせずに作った要素の場合はfalseを返す。
+func (e *intElement) Raw() (string, bool) {
+	return e.raw, e.raw != ""
+}
+
 type floatElement struct {
 	value float64
 	pos   Position
+	raw   string // ソースコード上の元の綴り。パースせずに作った要素では空になる。
 }
 
 // Position eのソースコード上の位置を返す。
@@ -223,9 +342,41 @@ func (e *floatElement) SymbolValue() (SymbolID, bool) {
 	return InvalidSymbolID, false
 }
 
+// BytesValue eがバイト列リテラルなら、バイト列リテラルの[]byteの値を返す。
+func (e *floatElement) BytesValue() ([]byte, bool) {
+	return nil, false
+}
+
+// RuneValue eが文字リテラルなら、文字リテラルのruneの値を返す。
+func (e *floatElement) RuneValue() (rune, bool) {
+	return 0, false
+}
+
+// Raw eのソースコード上の元の綴りを返す。パースせずに作った要素の場合はfalseを返す。
+func (e *floatElement) Raw() (string, bool) {
+	return e.raw, e.raw != ""
+}
+
 type stringElement struct {
 	value string
 	pos   Position
+	raw   string     // ソースコード上の元の綴り。パースせずに作った要素では空になる。
+	block *textBlock // テキストブロックから作った場合はその行の位置
+}
+
+// textBlock テキストブロックの最初と最後の行の位置
+type textBlock struct {
+	first Position
+	last  Position
+}
+
+// TextBlockLines eがテキストブロックから作った文字列なら、最初と最後の行の位置を返す。
+// 列番号は共通の字下げを取り除いた後の行の先頭を指す。空のテキストブロックの場合はどちらも閉じるTAGの位置になる。
+func TextBlockLines(e SyntaxElement) (Position, Position, bool) {
+	if v, ok := e.(*stringElement); ok && v.block != nil {
+		return v.block.first, v.block.last, true
+	}
+	return Position{}, Position{}, false
 }
 
 // Position eのソースコード上の位置を返す。
@@ -253,9 +404,117 @@ func (e *stringElement) SymbolValue() (SymbolID, bool) {
 	return InvalidSymbolID, false
 }
 
+// BytesValue eがバイト列リテラルなら、バイト列リテラルの[]byteの値を返す。
+func (e *stringElement) BytesValue() ([]byte, bool) {
+	return nil, false
+}
+
+// RuneValue eが文字リテラルなら、文字リテラルのruneの値を返す。
+func (e *stringElement) RuneValue() (rune, bool) {
+	return 0, false
+}
+
+// Raw eのソースコード上の元の綴りを返す。パースせずに作った要素の場合はfalseを返す。
+func (e *stringElement) Raw() (string, bool) {
+	return e.raw, e.raw != ""
+}
+
+type bytesElement struct {
+	value []byte
+	pos   Position
+	raw   string // ソースコード上の元の綴り。パースせずに作った要素では空になる。
+}
+
+// Position eのソースコード上の位置を返す。
+func (e *bytesElement) Position() Position {
+	return e.pos
+}
+
+// IntValue eが整数リテラルなら、整数リテラルのint64型の値を返す。
+func (e *bytesElement) IntValue() (int64, bool) {
+	return nilInt, false
+}
+
+// FloatValue eが浮動小数点数リテラルなら、浮動小数点数リテラルのfloat64の値を返す。
+func (e *bytesElement) FloatValue() (float64, bool) {
+	return nilFloat, false
+}
+
+// StringValue eが文字列リテラルなら、文字列リテラルのstringの値を返す。
+func (e *bytesElement) StringValue() (string, bool) {
+	return emptyString, false
+}
+
+// SymbolValue eがシンボルなら、リテラルのSymbolIDを返す。
+func (e *bytesElement) SymbolValue() (SymbolID, bool) {
+	return InvalidSymbolID, false
+}
+
+// BytesValue eがバイト列リテラルなら、バイト列リテラルの[]byteの値を返す。
+func (e *bytesElement) BytesValue() ([]byte, bool) {
+	return e.value, true
+}
+
+// RuneValue eが文字リテラルなら、文字リテラルのruneの値を返す。
+func (e *bytesElement) RuneValue() (rune, bool) {
+	return 0, false
+}
+
+// Raw eのソースコード上の元の綴りを返す。パースせずに作った要素の場合はfalseを返す。
+func (e *bytesElement) Raw() (string, bool) {
+	return e.raw, e.raw != ""
+}
+
+type charElement struct {
+	value rune
+	pos   Position
+	raw   string // ソースコード上の元の綴り。パースせずに作った要素では空になる。
+}
+
+// Position eのソースコード上の位置を返す。
+func (e *charElement) Position() Position {
+	return e.pos
+}
+
+// IntValue eが整数リテラルなら、整数リテラルのint64型の値を返す。
+func (e *charElement) IntValue() (int64, bool) {
+	return nilInt, false
+}
+
+// FloatValue eが浮動小数点数リテラルなら、浮動小数点数リテラルのfloat64の値を返す。
+func (e *charElement) FloatValue() (float64, bool) {
+	return nilFloat, false
+}
+
+// StringValue eが文字列リテラルなら、文字列リテラルのstringの値を返す。
+func (e *charElement) StringValue() (string, bool) {
+	return emptyString, false
+}
+
+// SymbolValue eがシンボルなら、リテラルのSymbolIDを返す。
+func (e *charElement) SymbolValue() (SymbolID, bool) {
+	return InvalidSymbolID, false
+}
+
+// BytesValue eがバイト列リテラルなら、バイト列リテラルの[]byteの値を返す。
+func (e *charElement) BytesValue() ([]byte, bool) {
+	return nil, false
+}
+
+// RuneValue eが文字リテラルなら、文字リテラルのruneの値を返す。
+func (e *charElement) RuneValue() (rune, bool) {
+	return e.value, true
+}
+
+// Raw eのソースコード上の元の綴りを返す。パースせずに作った要素の場合はfalseを返す。
+func (e *charElement) Raw() (string, bool) {
+	return e.raw, e.raw != ""
+}
+
 type symbolIDElement struct {
 	value SymbolID
 	pos   Position
+	raw   string // ソースコード上の元の綴り。パースせずに作った要素では空になる。
 }
 
 // Position eのソースコード上の位置を返す。
@@ -283,6 +542,21 @@ func (e *symbolIDElement) SymbolValue() (SymbolID, bool) {
 	return e.value, true
 }
 
+// BytesValue eがバイト列リテラルなら、バイト列リテラルの[]byteの値を返す。
+func (e *symbolIDElement) BytesValue() ([]byte, bool) {
+	return nil, false
+}
+
+// RuneValue eが文字リテラルなら、文字リテラルのruneの値を返す。
+func (e *symbolIDElement) RuneValue() (rune, bool) {
+	return 0, false
+}
+
+// Raw eのソースコード上の元の綴りを返す。パースせずに作った要素の場合はfalseを返す。
+func (e *symbolIDElement) Raw() (string, bool) {
+	return e.raw, e.raw != ""
+}
+
 // IsSymbolID 構文要素eがシンボルID idと等しいかテストする
 func IsSymbolID(e SyntaxElement, id SymbolID) bool {
 	if sid, ok := e.SymbolValue(); ok && sid == id {
@@ -320,3 +594,15 @@ func IsString(e SyntaxElement) bool {
 	_, ok := e.(*stringElement)
 	return ok
 }
+
+// IsBytes 構文要素eがバイト列かどうかテストする
+func IsBytes(e SyntaxElement) bool {
+	_, ok := e.(*bytesElement)
+	return ok
+}
+
+// IsChar 構文要素eが文字かどうかテストする
+func IsChar(e SyntaxElement) bool {
+	_, ok := e.(*charElement)
+	return ok
+}
@@ -62,3 +62,27 @@ func TestList3(t *testing.T) {
 		t.Error("Not matched.")
 	}
 }
+
+// customElement パッケージの外で実装されたSyntaxElementの代わり
+type customElement struct{}
+
+func (customElement) Position() Position            { return Position{} }
+func (customElement) IntValue() (int64, bool)       { return 7, true }
+func (customElement) FloatValue() (float64, bool)   { return 0, false }
+func (customElement) StringValue() (string, bool)   { return "", false }
+func (customElement) SymbolValue() (SymbolID, bool) { return InvalidSymbolID, false }
+func (customElement) BytesValue() ([]byte, bool)    { return nil, false }
+func (customElement) RuneValue() (rune, bool)       { return 0, false }
+
+func TestCustomElement(t *testing.T) {
+	lst := &ListElement{openchar: tokLeftParenthesis, elements: []SyntaxElement{customElement{}}}
+	if v, ok := lst.IntAt(0); !ok || v != 7 {
+		t.Errorf("Unexpected value %d", v)
+	}
+	if _, ok := Raw(lst.ElementAt(0)); ok {
+		t.Error("Custom element has raw text")
+	}
+	if _, err := Sprint(NewSymbolTable(), lst); err == nil {
+		t.Error("No error for unknown element type")
+	}
+}
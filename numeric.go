@@ -0,0 +1,235 @@
+package listparser
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumericSyntax NumericTypeが有効なときに数値として解釈するシンボルの記法を指定する。
+//
+// 常に解釈する記法は次の通りで、これ以外のシンボルはシンボルのままになる。
+//
+//	整数            ["-"] digits                          10進数。LeadingZeroOctalでなければ先頭の0は8進数を表さない。
+//	浮動小数点数    ["-"] digits "." [digits] [exponent]
+//	                ["-"] "." digits [exponent]
+//	                ["-"] digits exponent
+//	exponent        ("e" | "E") ["+" | "-"] digits
+//
+// 10進数の整数がint64に収まらない場合は浮動小数点数になる。各フィールドがtrueの場合はさらに次の記法を解釈する。
+type NumericSyntax struct {
+	// HexPrefix "0x"または"0X"で始まる16進数の整数
+	HexPrefix bool
+	// OctalPrefix "0o"または"0O"で始まる8進数の整数
+	OctalPrefix bool
+	// BinaryPrefix "0b"または"0B"で始まる2進数の整数
+	BinaryPrefix bool
+	// DigitSeparators 数字と数字の間の"_"(1_000_000)
+	DigitSeparators bool
+	// SpecialFloats 無限大と非数を表すinf, infinity, nan(大文字小文字を区別しない)。infには符号を付けられる。
+	SpecialFloats bool
+	// LeadingPlus 先頭の"+"(+5, +1.5)
+	LeadingPlus bool
+	// HexFloats 0x1.8p-2のような16進数の浮動小数点数。仮数部に続く2の冪の指数部は省略できない。
+	HexFloats bool
+	// LeadingZeroOctal "0"で始まる整数(0755)を8進数にする。以前のParseと同じ解釈で、互換性のために残している。
+	// 8と9を含む場合は10進数になる。
+	LeadingZeroOctal bool
+}
+
+// DefaultNumericSyntax ParseOptions.Numericがnilの場合に使う記法
+var DefaultNumericSyntax = NumericSyntax{HexPrefix: true, OctalPrefix: true, BinaryPrefix: true}
+
+// 数値の種類
+const (
+	notNumber   = iota
+	intNumber   = iota
+	floatNumber = iota
+)
+
+// parseNumber sをnsに従って解釈し、整数か浮動小数点数の値と種類を返す。数値でない場合はnotNumberを返す。
+func (ns *NumericSyntax) parseNumber(s string) (int64, float64, int) {
+	body, sign := s, ""
+	if len(body) > 0 && (body[0] == '-' || (body[0] == '+' && ns.LeadingPlus)) {
+		if body[0] == '-' {
+			sign = "-"
+		}
+		body = body[1:]
+	}
+
+	if ns.SpecialFloats {
+		switch strings.ToLower(body) {
+		case "inf", "infinity":
+			if sign == "-" {
+				return 0, math.Inf(-1), floatNumber
+			}
+			return 0, math.Inf(1), floatNumber
+		case "nan":
+			if body == s {
+				return 0, math.NaN(), floatNumber
+			}
+			return 0, 0, notNumber
+		}
+	}
+
+	if len(body) > 2 && body[0] == '0' {
+		switch body[1] {
+		case 'x', 'X':
+			if ns.HexFloats && strings.ContainsAny(body, ".pP") {
+				return ns.parseHexFloat(sign, body[2:])
+			}
+			if ns.HexPrefix {
+				return ns.parseInt(sign, body[2:], 16)
+			}
+			return 0, 0, notNumber
+		case 'o', 'O':
+			if ns.OctalPrefix {
+				return ns.parseInt(sign, body[2:], 8)
+			}
+			return 0, 0, notNumber
+		case 'b', 'B':
+			if ns.BinaryPrefix {
+				return ns.parseInt(sign, body[2:], 2)
+			}
+			return 0, 0, notNumber
+		}
+	}
+	if ns.LeadingZeroOctal && len(body) > 1 && body[0] == '0' {
+		if i, f, kind := ns.parseInt(sign, body[1:], 8); kind != notNumber {
+			return i, f, kind
+		}
+	}
+	return ns.parseDecimal(sign, body)
+}
+
+// digits sが基数baseの数字の並びであれば、区切りの"_"を取り除いて返す。
+func (ns *NumericSyntax) digits(s string, base int) (string, bool) {
+	if s == "" {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' {
+			if !ns.DigitSeparators || i == 0 || i == len(s)-1 || s[i+1] == '_' {
+				return "", false
+			}
+			continue
+		}
+		if !isDigitOf(c, base) {
+			return "", false
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), true
+}
+
+func isDigitOf(c byte, base int) bool {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c-'0') < base
+	case 'a' <= c && c <= 'f':
+		return base == 16
+	case 'A' <= c && c <= 'F':
+		return base == 16
+	}
+	return false
+}
+
+func (ns *NumericSyntax) parseInt(sign, s string, base int) (int64, float64, int) {
+	d, ok := ns.digits(s, base)
+	if !ok {
+		return 0, 0, notNumber
+	}
+	v, err := strconv.ParseInt(sign+d, base, 64)
+	if err != nil {
+		return 0, 0, notNumber
+	}
+	return v, 0, intNumber
+}
+
+// mantissa 整数部と小数部からなる仮数部sを区切りを取り除いて返す。どちらか一方は省略できる。
+func (ns *NumericSyntax) mantissa(s string, base int) (string, bool, bool) {
+	intPart, frac := s, ""
+	hasDot := false
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac, hasDot = s[:i], s[i+1:], true
+	}
+	if intPart == "" && frac == "" {
+		return "", false, false
+	}
+	var ok bool
+	if intPart != "" {
+		if intPart, ok = ns.digits(intPart, base); !ok {
+			return "", false, false
+		}
+	}
+	if frac != "" {
+		if frac, ok = ns.digits(frac, base); !ok {
+			return "", false, false
+		}
+	}
+	if hasDot {
+		return intPart + "." + frac, true, true
+	}
+	return intPart, false, true
+}
+
+// exponent 符号を付けられる10進数の指数部sを区切りを取り除いて返す。
+func (ns *NumericSyntax) exponent(s string) (string, bool) {
+	sign := ""
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		sign, s = s[:1], s[1:]
+	}
+	d, ok := ns.digits(s, 10)
+	return sign + d, ok
+}
+
+func (ns *NumericSyntax) parseDecimal(sign, s string) (int64, float64, int) {
+	mant, exp := s, ""
+	hasExp := false
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mant, exp, hasExp = s[:i], s[i+1:], true
+	}
+	m, hasDot, ok := ns.mantissa(mant, 10)
+	if !ok {
+		return 0, 0, notNumber
+	}
+	if !hasDot && !hasExp {
+		if v, err := strconv.ParseInt(sign+m, 10, 64); err == nil {
+			return v, 0, intNumber
+		}
+	}
+	if hasExp {
+		e, ok := ns.exponent(exp)
+		if !ok {
+			return 0, 0, notNumber
+		}
+		m += "e" + e
+	}
+	v, err := strconv.ParseFloat(sign+m, 64)
+	if err != nil {
+		return 0, 0, notNumber
+	}
+	return 0, v, floatNumber
+}
+
+func (ns *NumericSyntax) parseHexFloat(sign, s string) (int64, float64, int) {
+	i := strings.IndexAny(s, "pP")
+	if i < 0 {
+		return 0, 0, notNumber
+	}
+	m, _, ok := ns.mantissa(s[:i], 16)
+	if !ok {
+		return 0, 0, notNumber
+	}
+	e, ok := ns.exponent(s[i+1:])
+	if !ok {
+		return 0, 0, notNumber
+	}
+	v, err := strconv.ParseFloat(sign+"0x"+m+"p"+e, 64)
+	if err != nil {
+		return 0, 0, notNumber
+	}
+	return 0, v, floatNumber
+}
@@ -0,0 +1,139 @@
+package listparser
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNumericSyntax(t *testing.T) {
+	all := &NumericSyntax{true, true, true, true, true, true, true, false}
+	legacy := &NumericSyntax{HexPrefix: true, LeadingZeroOctal: true}
+	tests := []struct {
+		src  string
+		ns   *NumericSyntax
+		kind int
+		i    int64
+		f    float64
+	}{
+		{"0", &DefaultNumericSyntax, intNumber, 0, 0},
+		{"-42", &DefaultNumericSyntax, intNumber, -42, 0},
+		{"0755", &DefaultNumericSyntax, intNumber, 755, 0},
+		{"010", &DefaultNumericSyntax, intNumber, 10, 0},
+		{"-007", &DefaultNumericSyntax, intNumber, -7, 0},
+		{"0x1F", &DefaultNumericSyntax, intNumber, 31, 0},
+		{"-0o17", &DefaultNumericSyntax, intNumber, -15, 0},
+		{"0b101", &DefaultNumericSyntax, intNumber, 5, 0},
+		{"1.5", &DefaultNumericSyntax, floatNumber, 0, 1.5},
+		{"1.", &DefaultNumericSyntax, floatNumber, 0, 1},
+		{"-.5e1", &DefaultNumericSyntax, floatNumber, 0, -5},
+		{"2E-1", &DefaultNumericSyntax, floatNumber, 0, 0.2},
+		{"99999999999999999999", &DefaultNumericSyntax, floatNumber, 0, 1e20},
+		{"nan", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"inf", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"Infinity", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"1_000", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"+5", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"0x1p-2", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"0x", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"0b102", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"0xffffffffffffffffff", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"-", &DefaultNumericSyntax, notNumber, 0, 0},
+		{".", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"1e", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"e1", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"1.2.3", &DefaultNumericSyntax, notNumber, 0, 0},
+		{"0x1F", &NumericSyntax{}, notNumber, 0, 0},
+		{"1_000", all, intNumber, 1000, 0},
+		{"0x_ff", all, notNumber, 0, 0},
+		{"0xf_f", all, intNumber, 255, 0},
+		{"1__0", all, notNumber, 0, 0},
+		{"1_", all, notNumber, 0, 0},
+		{"1_000.000_5", all, floatNumber, 0, 1000.0005},
+		{"+5", all, intNumber, 5, 0},
+		{"+-5", all, notNumber, 0, 0},
+		{"0x1p-2", all, floatNumber, 0, 0.25},
+		{"-0x1.8P1", all, floatNumber, 0, -3},
+		{"0x1.8", all, notNumber, 0, 0},
+		{"0x1p-2", &NumericSyntax{HexPrefix: true}, notNumber, 0, 0},
+		{"Infinity", all, floatNumber, 0, math.Inf(1)},
+		{"-inf", all, floatNumber, 0, math.Inf(-1)},
+		{"-nan", all, notNumber, 0, 0},
+		{"0755", legacy, intNumber, 493, 0},
+		{"-010", legacy, intNumber, -8, 0},
+		{"0", legacy, intNumber, 0, 0},
+		{"09", legacy, intNumber, 9, 0},
+		{"0.5", legacy, floatNumber, 0, 0.5},
+		{"0x10", legacy, intNumber, 16, 0},
+		{"010", &NumericSyntax{DigitSeparators: true, LeadingZeroOctal: true}, intNumber, 8, 0},
+	}
+	for _, test := range tests {
+		i, f, kind := test.ns.parseNumber(test.src)
+		if kind != test.kind || i != test.i || f != test.f {
+			t.Errorf("Unexpected result %d %v %v for %q", kind, i, f, test.src)
+		}
+	}
+	if _, f, kind := all.parseNumber("NaN"); kind != floatNumber || !math.IsNaN(f) {
+		t.Error("Unexpected NaN")
+	}
+}
+
+func TestParseNumeric(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestParseNumeric", st, `(nan 1_000 0x10 inf)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if !IsSymbolID(lists[0].ElementAt(0), st.GetSymbolID("nan")) || !IsSymbol(lists[0].ElementAt(1)) || !IsSymbol(lists[0].ElementAt(3)) {
+		t.Error("Unexpected number")
+	}
+	if v, ok := lists[0].IntAt(2); !ok || v != 16 {
+		t.Error("Unexpected int")
+	}
+
+	// 以前のParseとは異なり、先頭の0は8進数を表さず、"_"の区切りと16進数の浮動小数点数はシンボルになる。
+	lists, err = ParseString("TestParseNumeric", st, `(010 0755 1_000 0x1p-2)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].IntAt(0); !ok || v != 10 {
+		t.Error("Unexpected int 010")
+	}
+	if v, ok := lists[0].IntAt(1); !ok || v != 755 {
+		t.Error("Unexpected int 0755")
+	}
+	if !IsSymbol(lists[0].ElementAt(2)) || !IsSymbol(lists[0].ElementAt(3)) {
+		t.Error("Unexpected number")
+	}
+	legacy := DefaultNumericSyntax
+	legacy.LeadingZeroOctal = true
+	lists, err = ParseStringWithOptions("TestParseNumeric", st, `(010 0755)`, ParseOptions{NumericType: true, Numeric: &legacy})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].IntAt(0); !ok || v != 8 {
+		t.Error("Unexpected octal 010")
+	}
+	if v, ok := lists[0].IntAt(1); !ok || v != 493 {
+		t.Error("Unexpected octal 0755")
+	}
+
+	lists, err = ParseStringWithOptions("TestParseNumeric", st, `(nan 1_000 +inf)`, ParseOptions{NumericType: true, Numeric: &NumericSyntax{DigitSeparators: true, SpecialFloats: true, LeadingPlus: true}})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].FloatAt(0); !ok || !math.IsNaN(v) {
+		t.Error("Unexpected nan")
+	}
+	if v, ok := lists[0].IntAt(1); !ok || v != 1000 {
+		t.Error("Unexpected int")
+	}
+	if v, ok := lists[0].FloatAt(2); !ok || !math.IsInf(v, 1) {
+		t.Error("Unexpected inf")
+	}
+	if s, err := Sprint(st, lists[0]); err != nil || s != "(nan 1_000 +inf)" {
+		t.Errorf("Unexpected print %q", s)
+	}
+	if s, err := Sprint(st, &floatElement{math.Inf(-1), Position{}, ""}); err != nil || s != "-inf" {
+		t.Errorf("Unexpected print %q", s)
+	}
+}
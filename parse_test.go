@@ -219,3 +219,451 @@ func TestParse13(t *testing.T) {
 		}
 	}
 }
+
+func TestParseReaderMacros(t *testing.T) {
+	src := `'(a ` + "`" + `(b ,c ,@d) ''e)`
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestParseReaderMacros", st, src, ParseOptions{ReaderMacros: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if len(lists) != 1 || lists[0].Len() != 2 || !IsSymbolID(lists[0].ElementAt(0), st.GetSymbolID("quote")) {
+		t.Fatalf("Unexpected result")
+	}
+	body := lists[0].ElementAt(1).(*ListElement)
+	if body.Len() != 3 {
+		t.Fatalf("Unexpected list length %d", body.Len())
+	}
+
+	qq := body.ElementAt(1).(*ListElement)
+	if !IsSymbolID(qq.ElementAt(0), st.GetSymbolID("quasiquote")) || qq.Position().Column != 5 {
+		t.Errorf("Unexpected quasiquote at %v", qq.Position())
+	}
+	inner := qq.ElementAt(1).(*ListElement)
+	uq := inner.ElementAt(1).(*ListElement)
+	if uq.Len() != 2 || !IsSymbolID(uq.ElementAt(0), st.GetSymbolID("unquote")) || !IsSymbol(uq.ElementAt(1)) {
+		t.Error("Unexpected unquote")
+	}
+	uqs := inner.ElementAt(2).(*ListElement)
+	if uqs.Len() != 2 || !IsSymbolID(uqs.ElementAt(0), st.GetSymbolID("unquote-splicing")) || uqs.Position().Column != 12 {
+		t.Error("Unexpected unquote-splicing")
+	}
+
+	q2 := body.ElementAt(2).(*ListElement)
+	q3, ok := q2.ElementAt(1).(*ListElement)
+	if !ok || !IsSymbolID(q3.ElementAt(0), st.GetSymbolID("quote")) || !IsSymbol(q3.ElementAt(1)) {
+		t.Error("Unexpected nested quote")
+	}
+}
+
+func TestParseReaderMacrosDisabled(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestParseReaderMacrosDisabled", st, `('a ,b)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].SymbolAt(0); !ok || v != st.GetSymbolID("'a") {
+		t.Error("Unexpected symbol")
+	}
+}
+
+func TestParseReaderMacrosError(t *testing.T) {
+	for _, src := range []string{`(a ')`, `(a ,`} {
+		st := NewSymbolTable()
+		_, err := ParseStringWithOptions("TestParseReaderMacrosError", st, src, ParseOptions{ReaderMacros: true})
+		pe, ok := err.(*ParseError)
+		if !ok || pe.ID != ErrorMissingQuotedElement {
+			t.Errorf("Unexpected error \"%v\" for %s", err, src)
+		}
+	}
+}
+
+func TestParseByteStrings(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestParseByteStrings", st, `(#"a\x00\xff" "\xe3\x81\x82" #"")`, ParseOptions{ByteStrings: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].BytesAt(0); !ok || string(v) != "a\x00\xff" || !IsBytes(lists[0].ElementAt(0)) {
+		t.Errorf("Unexpected bytes %q", v)
+	}
+	if v, ok := lists[0].StringAt(1); !ok || v != "あ" {
+		t.Errorf("Unexpected string %q", v)
+	}
+	if v, ok := lists[0].BytesAt(2); !ok || len(v) != 0 {
+		t.Errorf("Unexpected bytes %q", v)
+	}
+	if _, ok := lists[0].BytesAt(1); ok {
+		t.Error("String is bytes")
+	}
+
+	lists, err = ParseString("TestParseByteStrings", st, `(#"a")`, false, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].SymbolAt(0); !ok || v != st.GetSymbolID(`#"a"`) {
+		t.Error("Unexpected symbol")
+	}
+
+	_, err = ParseStringWithOptions("TestParseByteStrings", st, `(a "\uDC00")`, ParseOptions{})
+	if perr, ok := err.(*ParseError); !ok || perr.ID != ErrorLexingError || perr.InnerError != ErrorSurrogateCodePoint {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
+
+func TestParseRawStrings(t *testing.T) {
+	st := NewSymbolTable()
+	src := "(re #r\"^\\d+\\.\\d+$\"\n  doc #r\"line1\n  line2\" end)"
+	lists, err := ParseStringWithOptions("TestParseRawStrings", st, src, ParseOptions{RawStrings: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].StringAt(1); !ok || v != `^\d+\.\d+$` {
+		t.Errorf("Unexpected string %q", v)
+	}
+	if v, ok := lists[0].StringAt(3); !ok || v != "line1\n  line2" || lists[0].ElementAt(3).Position() != (Position{"TestParseRawStrings", 2, 7}) {
+		t.Errorf("Unexpected string %q", v)
+	}
+	if pos := lists[0].ElementAt(4).Position(); pos != (Position{"TestParseRawStrings", 3, 10}) {
+		t.Errorf("Unexpected position %v", pos)
+	}
+	if s, err := Sprint(st, lists[0]); err != nil || s != "(re #r\"^\\d+\\.\\d+$\" doc #r\"line1\n  line2\" end)" {
+		t.Errorf("Unexpected result %q", s)
+	}
+}
+
+func TestParseTextBlocks(t *testing.T) {
+	st := NewSymbolTable()
+	src := `(doc #<<END
+    <p>
+      hello   
+
+    </p>
+    END) (empty #<<EOS
+  EOS
+  x)
+(ending #<<END
+  ENDING
+  END
+)`
+	lists, err := ParseStringWithOptions("TestParseTextBlocks", st, src, ParseOptions{TextBlocks: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].StringAt(1); !ok || v != "<p>\n  hello\n\n</p>\n" {
+		t.Errorf("Unexpected string %q", v)
+	}
+	first, last, ok := TextBlockLines(lists[0].ElementAt(1))
+	if !ok || first != (Position{"TestParseTextBlocks", 2, 5}) || last != (Position{"TestParseTextBlocks", 5, 5}) {
+		t.Errorf("Unexpected lines %v %v", first, last)
+	}
+	if lists[0].ElementAt(1).Position() != (Position{"TestParseTextBlocks", 1, 6}) {
+		t.Errorf("Unexpected position %v", lists[0].ElementAt(1).Position())
+	}
+	if v, ok := lists[1].StringAt(1); !ok || v != "" {
+		t.Errorf("Unexpected string %q", v)
+	}
+	first, last, ok = TextBlockLines(lists[1].ElementAt(1))
+	if !ok || first != (Position{"TestParseTextBlocks", 7, 3}) || last != first {
+		t.Errorf("Unexpected lines %v %v", first, last)
+	}
+	if pos := lists[1].ElementAt(2).Position(); pos != (Position{"TestParseTextBlocks", 8, 3}) {
+		t.Errorf("Unexpected position %v", pos)
+	}
+	if v, ok := lists[2].StringAt(1); !ok || v != "ENDING\n" {
+		t.Errorf("Unexpected string %q", v)
+	}
+	if _, _, ok := TextBlockLines(lists[0].ElementAt(0)); ok {
+		t.Error("Symbol is a text block")
+	}
+	if s, err := Sprint(st, lists[0]); err != nil || s != "(doc #<<END\n    <p>\n      hello   \n\n    </p>\n    END)" {
+		t.Errorf("Unexpected result %q", s)
+	}
+
+	tests := []struct {
+		src string
+		err error
+	}{
+		{"(a #<<\nEND\n)", ErrorInvalidTextBlock},
+		{"(a #<<A B\nA B\n)", ErrorInvalidTextBlock},
+		{"(a #<<END\n  ENDX\n)", ErrorUnterminatedTextBlock},
+		{"(a #<<END\n  END of story\n)", ErrorUnterminatedTextBlock},
+		{"(a #<<END\n  END ;comment\n)", ErrorUnterminatedTextBlock},
+	}
+	for _, test := range tests {
+		_, err := ParseStringWithOptions("TestParseTextBlocks", st, test.src, ParseOptions{TextBlocks: true})
+		if perr, ok := err.(*ParseError); !ok || perr.InnerError != test.err || perr.ErrorLocation != (Position{"TestParseTextBlocks", 1, 4}) {
+			t.Errorf("Unexpected error \"%v\" for %q", err, test.src)
+		}
+	}
+}
+
+func TestParseCharLiterals(t *testing.T) {
+	st := NewSymbolTable()
+	src := `(#\a #\space #\x3042 #\( #\) #\あ #\x #\; " ")`
+	lists, err := ParseStringWithOptions("TestParseCharLiterals", st, src, ParseOptions{CharLiterals: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	expected := []rune{'a', ' ', 'あ', '(', ')', 'あ', 'x', ';'}
+	for i, r := range expected {
+		if v, ok := lists[0].RuneAt(i); !ok || v != r || !IsChar(lists[0].ElementAt(i)) {
+			t.Errorf("Unexpected char %q at %d", v, i)
+		}
+	}
+	if pos := lists[0].ElementAt(3).Position(); pos != (Position{"TestParseCharLiterals", 1, 22}) {
+		t.Errorf("Unexpected position %v", pos)
+	}
+	if _, ok := lists[0].RuneAt(8); ok || Equal(lists[0].ElementAt(1), lists[0].ElementAt(8)) {
+		t.Error("String is a char")
+	}
+	if !Equal(lists[0].ElementAt(2), lists[0].ElementAt(5)) || Hash(lists[0].ElementAt(2)) != Hash(lists[0].ElementAt(5)) {
+		t.Error("Unexpected equality")
+	}
+
+	tests := []struct {
+		src string
+		err error
+	}{
+		{"(a #\\\n)", ErrorInvalidCharacterLiteral},
+		{`(#\spaces)`, ErrorInvalidCharacterLiteral},
+		{`(#\x1234567)`, ErrorInvalidCharacterLiteral},
+		{`(#\xd800)`, ErrorSurrogateCodePoint},
+		{`(#\x110000)`, ErrorInvalidCodePoint},
+	}
+	for _, test := range tests {
+		_, err := ParseStringWithOptions("TestParseCharLiterals", st, test.src, ParseOptions{CharLiterals: true})
+		if perr, ok := err.(*ParseError); !ok || perr.InnerError != test.err {
+			t.Errorf("Unexpected error \"%v\" for %s", err, test.src)
+		}
+	}
+}
+
+func TestParseQuotedSymbols(t *testing.T) {
+	st := NewSymbolTable()
+	src := `(|a b| |(x);| |\|\x41\u{3042}| || |12| "s" a|b)`
+	lists, err := ParseStringWithOptions("TestParseQuotedSymbols", st, src, ParseOptions{NumericType: true, StringAsSymbol: true, QuotedSymbols: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	expected := []string{"a b", "(x);", "|Aあ", "", "12", "s", "a|b"}
+	for i, name := range expected {
+		if v, ok := lists[0].SymbolAt(i); !ok || v != st.GetSymbolID(name) {
+			t.Errorf("Unexpected symbol at %d", i)
+		}
+	}
+	if pos := lists[0].ElementAt(1).Position(); pos != (Position{"TestParseQuotedSymbols", 1, 8}) {
+		t.Errorf("Unexpected position %v", pos)
+	}
+
+	lists, err = ParseString("TestParseQuotedSymbols", st, `(|a)`, false, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].SymbolAt(0); !ok || v != st.GetSymbolID("|a") {
+		t.Error("Unexpected symbol")
+	}
+
+	_, err = ParseStringWithOptions("TestParseQuotedSymbols", st, "(|a\n|)", ParseOptions{QuotedSymbols: true})
+	if perr, ok := err.(*ParseError); !ok || perr.InnerError != ErrorUnexpectedEndOfLine {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
+
+func TestParseDottedPairs(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{NumericType: true, ReaderMacros: true, QuotedSymbols: true, DottedPairs: true}
+	lists, err := ParseStringWithOptions("TestParseDottedPairs", st, `(a . 1) (a b . (c)) [x . 'y] (a |.| b) (a .b)`, opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if tail, ok := lists[0].Tail(); !ok || lists[0].Len() != 1 || !IsInt(tail) {
+		t.Error("Unexpected pair")
+	}
+	if tail, ok := lists[1].Tail(); !ok || lists[1].Len() != 2 || !IsList(tail) || tail.Position() != (Position{"TestParseDottedPairs", 1, 16}) {
+		t.Error("Unexpected improper list")
+	}
+	if tail, ok := lists[2].Tail(); !ok || lists[2].openchar != tokLeftSquareBracket || !IsList(tail) {
+		t.Error("Unexpected quoted tail")
+	}
+	for _, lst := range lists[3:] {
+		if _, ok := lst.Tail(); ok || lst.Len() == 1 {
+			t.Errorf("Unexpected dotted pair at %v", lst.Position())
+		}
+	}
+
+	lists, err = ParseString("TestParseDottedPairs", st, `(a . b)`, false, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if _, ok := lists[0].Tail(); ok || !IsSymbolID(lists[0].ElementAt(1), st.GetSymbolID(".")) {
+		t.Error("Dot was parsed without DottedPairs")
+	}
+
+	tests := []struct {
+		src string
+		pos Position
+	}{
+		{`( . a)`, Position{"TestParseDottedPairs", 1, 3}},
+		{`(a . )`, Position{"TestParseDottedPairs", 1, 4}},
+		{`(a . b c)`, Position{"TestParseDottedPairs", 1, 4}},
+		{`(a . b . c)`, Position{"TestParseDottedPairs", 1, 8}},
+		{`(a '. b)`, Position{"TestParseDottedPairs", 1, 5}},
+	}
+	for _, test := range tests {
+		_, err := ParseStringWithOptions("TestParseDottedPairs", st, test.src, opts)
+		if perr, ok := err.(*ParseError); !ok || perr.ID != ErrorInvalidDottedPair || perr.ErrorLocation != test.pos {
+			t.Errorf("Unexpected error \"%v\" for %s", err, test.src)
+		}
+	}
+}
+
+func TestParseDatumLabels(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{NumericType: true, ReaderMacros: true, DottedPairs: true, DatumLabels: true}
+	src := `(a #0=(b c) #0# #1=x #1#)
+#0=(loop . #0#)
+(#10=[d '#10#] #2 #3a)`
+	lists, err := ParseStringWithOptions("TestParseDatumLabels", st, src, opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if lists[0].ElementAt(1) != lists[0].ElementAt(2) || lists[0].ElementAt(3) != lists[0].ElementAt(4) {
+		t.Error("References are not shared")
+	}
+	if pos := lists[0].ElementAt(2).Position(); pos != (Position{"TestParseDatumLabels", 1, 7}) {
+		t.Errorf("Unexpected position %v", pos)
+	}
+	if tail, ok := lists[1].Tail(); !ok || tail != lists[1] {
+		t.Error("Unexpected cycle")
+	}
+	inner := lists[2].ElementAt(0).(*ListElement)
+	quoted := inner.ElementAt(1).(*ListElement)
+	if quoted.ElementAt(1) != inner {
+		t.Error("Unexpected quoted reference")
+	}
+	if !IsSymbolID(lists[2].ElementAt(1), st.GetSymbolID("#2")) || !IsSymbolID(lists[2].ElementAt(2), st.GetSymbolID("#3a")) {
+		t.Error("Unexpected symbols")
+	}
+
+	lists, err = ParseString("TestParseDatumLabels", st, `(#0=a #0#)`, false, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if !IsSymbolID(lists[0].ElementAt(0), st.GetSymbolID("#0=a")) || !IsSymbolID(lists[0].ElementAt(1), st.GetSymbolID("#0#")) {
+		t.Error("Labels were parsed without DatumLabels")
+	}
+
+	tests := []struct {
+		src string
+		id  int
+		pos Position
+	}{
+		{`(#0#)`, ErrorUndefinedDatumLabel, Position{"TestParseDatumLabels", 1, 2}},
+		{`(#0=#0#)`, ErrorUndefinedDatumLabel, Position{"TestParseDatumLabels", 1, 5}},
+		{"(#0=a)\n(#0#)", ErrorUndefinedDatumLabel, Position{"TestParseDatumLabels", 2, 2}},
+		{`(#0=a #0=b)`, ErrorDuplicateDatumLabel, Position{"TestParseDatumLabels", 1, 7}},
+		{`(a #0=)`, ErrorMissingLabeledElement, Position{"TestParseDatumLabels", 1, 4}},
+		{`(a) #0=`, ErrorMissingLabeledElement, Position{"TestParseDatumLabels", 1, 5}},
+		{`(a) #0#`, ErrorTopLevelElementMustBeAList, Position{"TestParseDatumLabels", 1, 5}},
+		{`(#99999999999=a)`, ErrorLexingError, Position{"TestParseDatumLabels", 1, 2}},
+	}
+	for _, test := range tests {
+		_, err := ParseStringWithOptions("TestParseDatumLabels", st, test.src, opts)
+		if perr, ok := err.(*ParseError); !ok || perr.ID != test.id || perr.ErrorLocation != test.pos {
+			t.Errorf("Unexpected error \"%v\" for %s", err, test.src)
+		}
+	}
+}
+
+func TestParseTaggedLists(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{NumericType: true, RawStrings: true, DatumLabels: true, TaggedLists: true}
+	lists, err := ParseStringWithOptions("TestParseTaggedLists", st, `(#(1 2) #[a] #set{x y} #r(1) #0=#rec(#0#) #tag (b))`, opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	expected := []struct {
+		tag      string
+		openchar rune
+		column   int
+	}{
+		{"", tokLeftParenthesis, 2},
+		{"", tokLeftSquareBracket, 9},
+		{"set", tokLeftCurlyBracket, 14},
+		{"r", tokLeftParenthesis, 24},
+		{"rec", tokLeftParenthesis, 33},
+	}
+	if _, ok := st.LookupSymbolID(""); ok {
+		t.Error("Anonymous tag was added to the symbol table")
+	}
+	for i, e := range expected {
+		lst := lists[0].ElementAt(i).(*ListElement)
+		var id SymbolID = InvalidSymbolID
+		if e.tag != "" {
+			id = st.GetSymbolID(e.tag)
+		}
+		if tag, ok := lst.Tag(); !ok || tag != id || lst.Bracket() != e.openchar {
+			t.Errorf("Unexpected tag at %d", i)
+		}
+		if pos := lst.Position(); pos != (Position{"TestParseTaggedLists", 1, e.column}) {
+			t.Errorf("Unexpected position %v at %d", pos, i)
+		}
+	}
+	if lst := lists[0].ElementAt(4).(*ListElement); lst.ElementAt(0) != lst {
+		t.Error("Unexpected labeled tagged list")
+	}
+	if !IsSymbolID(lists[0].ElementAt(5), st.GetSymbolID("#tag")) {
+		t.Error("Unexpected symbol")
+	}
+	if _, ok := lists[0].ElementAt(6).(*ListElement).Tag(); ok {
+		t.Error("Separated list was tagged")
+	}
+	if _, ok := lists[0].Tag(); ok {
+		t.Error("Unexpected tag")
+	}
+
+	lists, err = ParseStringWithOptions("TestParseTaggedLists", st, `#vec[1 2]`, opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if tag, ok := lists[0].Tag(); !ok || tag != st.GetSymbolID("vec") || lists[0].Len() != 2 {
+		t.Error("Unexpected top-level tagged list")
+	}
+
+	lists, err = ParseString("TestParseTaggedLists", st, `(#set(a))`, false, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if !IsSymbolID(lists[0].ElementAt(0), st.GetSymbolID("#set")) || !IsList(lists[0].ElementAt(1)) {
+		t.Error("Tag was parsed without TaggedLists")
+	}
+}
+
+func TestParseAnonymousTagsFrozenTable(t *testing.T) {
+	st := NewSymbolTableWithNames("a")
+	st.Freeze()
+	lists, err := ParseStringWithOptions("TestParseAnonymousTagsFrozenTable", st, `#[a #(a) #{a}]`, ParseOptions{TaggedLists: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	for i, lst := range []*ListElement{lists[0], lists[0].ElementAt(1).(*ListElement), lists[0].ElementAt(2).(*ListElement)} {
+		if tag, ok := lst.Tag(); !ok || tag != InvalidSymbolID || lst.Bracket() != []rune{tokLeftSquareBracket, tokLeftParenthesis, tokLeftCurlyBracket}[i] {
+			t.Errorf("Unexpected tag at %d", i)
+		}
+	}
+	if s, err := Sprint(st, lists[0]); err != nil || s != "#[a #(a) #{a}]" {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestParseTextBlockTagInContent(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestParseTextBlockTagInContent", st, "(a #<<END\n  END of story\n  END  \n)", ParseOptions{TextBlocks: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v, ok := lists[0].StringAt(1); !ok || v != "END of story\n" || lists[0].Len() != 2 {
+		t.Errorf("Unexpected string %q", v)
+	}
+}
@@ -2,10 +2,12 @@ package listparser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // 構文解析のエラーメッセージの定義
@@ -16,6 +18,27 @@ const (
 	ErrorTopLevelElementMustBeAList     = iota
 	ErrorMissingClosingParenthesis      = iota
 	ErrorLexingError                    = iota
+	ErrorMissingPropertyValue           = iota
+	ErrorPropertyKeyMustBeASymbol       = iota
+	ErrorAssociationMustBeAPair         = iota
+	ErrorMissingQuotedElement           = iota
+	ErrorTemplateMustBeASingleList      = iota
+	ErrorInvalidPlaceholder             = iota
+	ErrorUnboundPlaceholder             = iota
+	ErrorSpliceMustBeAList              = iota
+	ErrorInvalidQuery                   = iota
+	ErrorInvalidPattern                 = iota
+	ErrorDuplicatePatternVariable       = iota
+	ErrorInvalidInclude                 = iota
+	ErrorIncludeFailed                  = iota
+	ErrorIncludeCycle                   = iota
+	ErrorInvalidJSON                    = iota
+	ErrorUnknownSymbol                  = iota
+	ErrorInvalidSchema                  = iota
+	ErrorInvalidDottedPair              = iota
+	ErrorUndefinedDatumLabel            = iota
+	ErrorDuplicateDatumLabel            = iota
+	ErrorMissingLabeledElement          = iota
 )
 
 var errorMessages map[int]string
@@ -28,6 +51,27 @@ func init() {
 		ErrorTopLevelElementMustBeAList:     "Top-level element must be a list",
 		ErrorMissingClosingParenthesis:      "Missing closing parenthesis",
 		ErrorLexingError:                    "Lexing error:",
+		ErrorMissingPropertyValue:           "Missing property value",
+		ErrorPropertyKeyMustBeASymbol:       "Property key must be a symbol",
+		ErrorAssociationMustBeAPair:         "Association must be a pair",
+		ErrorMissingQuotedElement:           "Missing element after quote",
+		ErrorTemplateMustBeASingleList:      "Template must be a single list",
+		ErrorInvalidPlaceholder:             "Placeholder must be a symbol",
+		ErrorUnboundPlaceholder:             "Unbound placeholder:",
+		ErrorSpliceMustBeAList:              "Spliced value must be a list",
+		ErrorInvalidQuery:                   "Invalid query",
+		ErrorInvalidPattern:                 "Invalid pattern",
+		ErrorDuplicatePatternVariable:       "Duplicate pattern variable",
+		ErrorInvalidInclude:                 "Invalid include directive",
+		ErrorIncludeFailed:                  "Include failed:",
+		ErrorIncludeCycle:                   "Include cycle:",
+		ErrorInvalidJSON:                    "Invalid JSON:",
+		ErrorUnknownSymbol:                  "Unknown symbol:",
+		ErrorInvalidSchema:                  "Invalid schema:",
+		ErrorInvalidDottedPair:              "Invalid dotted pair",
+		ErrorUndefinedDatumLabel:            "Undefined datum label:",
+		ErrorDuplicateDatumLabel:            "Duplicate datum label:",
+		ErrorMissingLabeledElement:          "Missing element after datum label",
 	}
 }
 
@@ -65,14 +109,200 @@ type Position struct {
 	Column   int
 }
 
+// ParseOptions パースの動作を指定する。
+type ParseOptions struct {
+	// NumericType 整数または浮動小数点数として解釈できるシンボルを数値にする。
+	NumericType bool
+	// Numeric NumericTypeが有効なときに数値として解釈する記法。nilの場合はDefaultNumericSyntax。
+	Numeric *NumericSyntax
+	// StringAsSymbol 文字列リテラルをシンボルとして扱う。
+	StringAsSymbol bool
+	// ReaderMacros 'x `x ,x ,@xをそれぞれ(quote x) (quasiquote x) (unquote x) (unquote-splicing x)に展開する。
+	ReaderMacros bool
+	// ByteStrings #"..."をバイト列リテラルとして扱う。無効な場合は'#'で始まるシンボルになる。
+	ByteStrings bool
+	// RawStrings #r"..."をエスケープシーケンスを解釈しない文字列リテラルとして扱う。
+	// #r#"..."#のように'"'の前後に同じ数の'#'を付けると、'"'を含む文字列を書ける。生文字列リテラルは行をまたいでもよい。
+	RawStrings bool
+	// TextBlocks #<<TAGから、TAGだけを書いた行までをテキストブロックとして扱う。
+	// TAGの直後には閉じるカッコを続けて書ける(END)のように)。"END of story"のような行はテキストブロックの内容になる。
+	// テキストブロックは間の行を改行で終わる行として並べた文字列リテラルになる。
+	// 空白だけの行を除いた行と閉じるTAGの行に共通する先頭の空白と、各行の末尾の空白は取り除かれる。
+	TextBlocks bool
+	// CharLiterals #\a、#\space、#\x3042のような文字リテラルを扱う。
+	CharLiterals bool
+	// QuotedSymbols |で始まるトークンを、次の|までをシンボル名とするシンボルとして扱う。
+	// |a b|のように空白やカッコを含むシンボルを書ける。|の間では文字列リテラルと同じエスケープシーケンスと\|を使える。
+	QuotedSymbols bool
+	// DottedPairs (a . b)や(a b . c)をドット対として扱い、"."の後ろの要素をListElement.Tailで返す。
+	// "."の前には一つ以上、後ろにはちょうど一つの要素がなければならない。無効な場合は"."はシンボルになる。
+	DottedPairs bool
+	// DatumLabels #N=で次の要素にラベルNを付け、#N#をその要素への参照として扱う。Nは10進数の整数。
+	// 参照は同じ要素(リストの場合は同じ*ListElement)になるので、#0=(a . #0#)のような循環するリストも書ける。
+	// ラベルはトップレベルのリストごとに有効で、定義より前やラベルを付けた要素が始まる前には参照できない。
+	DatumLabels bool
+	// TaggedLists #(...)、#[...]、#name(...)のように'#'とシンボル名の直後に開くカッコを書いたリストを、タグ付きのリストとして扱う。
+	// タグはListElement.Tagで返し、#(...)と#[...]のタグは名前のないInvalidSymbolIDになる。無効な場合は'#'で始まるシンボルとリストになる。
+	TaggedLists bool
+	// Include nilでない場合、トップレベルの(include "path")をIncludeで読み込んだファイルのリストに置き換える。
+	Include IncludeResolver
+	// IncludeDirective includeの代わりに使うシンボル名。空の場合は"include"。
+	IncludeDirective string
+}
+
+// リーダーマクロの展開先のシンボル名
+var readerMacroNames = map[rune]string{
+	tokQuote:        "quote",
+	tokQuasiquote:   "quasiquote",
+	tokUnquote:      "unquote",
+	unquoteSplicing: "unquote-splicing",
+}
+
 // Parse srcをスキャンして*Listの配列を返す。
+// numericTypeが有効な場合はDefaultNumericSyntaxで数値を解釈する。以前のバージョンとは次の点が異なる。
+// 010や0755のような先頭の0は8進数ではなく10進数になる(NumericSyntax.LeadingZeroOctalで以前の解釈にできる)。
+// inf, nan, 1_000, +5, 0x1p-2はシンボルのままになる(NumericSyntaxのそれぞれの記法を有効にすると数値になる)。
 func Parse(filename string, st *SymbolTable, src io.Reader, numericType bool, stringAsSymbol bool) ([]*ListElement, error) {
+	return ParseWithOptions(filename, st, src, ParseOptions{NumericType: numericType, StringAsSymbol: stringAsSymbol})
+}
+
+// closeReaderMacros 要素を一つ読み終えたリーダーマクロのリストをスタックから取り除く。
+func closeReaderMacros(stack *stack) {
+	for lst := stack.peek(); lst != nil && lst.macro != 0 && len(lst.elements) == 2; lst = stack.peek() {
+		stack.pop()
+	}
+}
+
+// dotSymbol ドット対の"."
+const dotSymbol = "."
+
+// dottedPair 閉じる前のリストの中に現れた"."の位置
+type dottedPair struct {
+	index int
+	pos   Position
+}
+
+// closeDottedPair lstの中に"."があれば、その後ろの要素をlstのtailに移す。
+func closeDottedPair(dots map[*ListElement]dottedPair, lst *ListElement) error {
+	dot, ok := dots[lst]
+	if !ok {
+		return nil
+	}
+	delete(dots, lst)
+	if len(lst.elements)-dot.index != 1 {
+		return newParseError(dot.pos.Filename, dot.pos.Line, dot.pos.Column, ErrorInvalidDottedPair, nil)
+	}
+	lst.tail = lst.elements[dot.index]
+	lst.elements = lst.elements[:dot.index]
+	return nil
+}
+
+// pendingLabel ラベルを付ける要素がまだ現れていない#N=
+type pendingLabel struct {
+	label  string
+	parent *ListElement // トップレベルの場合はnil
+	index  int          // ラベルを付ける要素のparentでの添字
+	pos    Position
+}
+
+// datumLabels パース中のデータラベルと、そのラベルを付けた要素
+type datumLabels struct {
+	elements map[string]SyntaxElement
+	pending  []pendingLabel
+}
+
+func newDatumLabels() *datumLabels {
+	return &datumLabels{make(map[string]SyntaxElement), make([]pendingLabel, 0)}
+}
+
+// define #N=を読み込んだときに、次の要素にラベルを付けるよう登録する。
+func (dl *datumLabels) define(label string, parent *ListElement, index int, pos Position) error {
+	_, ok := dl.elements[label]
+	for _, p := range dl.pending {
+		ok = ok || p.label == label
+	}
+	if ok {
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorDuplicateDatumLabel, errors.New(label))
+	}
+	dl.pending = append(dl.pending, pendingLabel{label, parent, index, pos})
+	return nil
+}
+
+// bind ラベルを付ける要素が現れた#N=の要素を確定する。リストは開いた時点で確定するので、その子要素から参照できる。
+func (dl *datumLabels) bind(lists []*ListElement) {
+	rest := dl.pending[:0]
+	for _, p := range dl.pending {
+		if p.parent == nil && p.index < len(lists) {
+			dl.elements[p.label] = lists[p.index]
+		} else if p.parent != nil && p.index < len(p.parent.elements) {
+			dl.elements[p.label] = p.parent.elements[p.index]
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	dl.pending = rest
+}
+
+// checkClosed lstを閉じるときに、lstの中にラベルを付ける要素が現れていない#N=があればエラーを返す。
+func (dl *datumLabels) checkClosed(lst *ListElement) error {
+	for _, p := range dl.pending {
+		if p.parent == lst {
+			return newParseError(p.pos.Filename, p.pos.Line, p.pos.Column, ErrorMissingLabeledElement, nil)
+		}
+	}
+	return nil
+}
+
+// reference #N#が参照する要素を返す。
+func (dl *datumLabels) reference(label string, pos Position) (SyntaxElement, error) {
+	e, ok := dl.elements[label]
+	if !ok {
+		return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorUndefinedDatumLabel, errors.New(label))
+	}
+	return e, nil
+}
+
+// newSymbol nameのシンボルを作る。stがFreezeされていてnameが登録されていない場合はエラーを返す。
+// rawはソースコード上の元の綴り。
+func newSymbol(st *SymbolTable, name string, pos Position, raw string) (*symbolIDElement, error) {
+	id := st.GetSymbolID(name)
+	if id == InvalidSymbolID {
+		return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorUnknownSymbol, errors.New(name))
+	}
+	return &symbolIDElement{id, pos, raw}, nil
+}
+
+// ParseWithOptions optsに従ってsrcをスキャンして*Listの配列を返す。
+func ParseWithOptions(filename string, st *SymbolTable, src io.Reader, opts ParseOptions) ([]*ListElement, error) {
+	lists, err := parseLists(filename, st, src, opts)
+	if err != nil || opts.Include == nil {
+		return lists, err
+	}
+	return expandIncludes(lists, []string{filename}, st, opts)
+}
+
+func parseLists(filename string, st *SymbolTable, src io.Reader, opts ParseOptions) ([]*ListElement, error) {
 	lists := make([]*ListElement, 0)
 	stack := newStack()
 	lexer, err := newLexer(filename, src)
 	if err != nil {
 		return nil, err
 	}
+	lexer.readerMacros = opts.ReaderMacros
+	lexer.byteStrings = opts.ByteStrings
+	lexer.rawStrings = opts.RawStrings
+	lexer.textBlocks = opts.TextBlocks
+	lexer.charLiterals = opts.CharLiterals
+	lexer.quotedSymbols = opts.QuotedSymbols
+	lexer.datumLabels = opts.DatumLabels
+	lexer.taggedLists = opts.TaggedLists
+	numeric := opts.Numeric
+	if numeric == nil {
+		numeric = &DefaultNumericSyntax
+	}
+	dots := make(map[*ListElement]dottedPair)
+	labels := newDatumLabels()
+	var tag *symbolIDElement // 次の開くカッコのリストに付けるタグ
 	tok, line, column, err := lexer.scan()
 	for err == nil {
 		toktxt := lexer.tokentext()
@@ -82,40 +312,143 @@ func Parse(filename string, st *SymbolTable, src io.Reader, numericType bool, st
 			if lst == nil {
 				return nil, newParseError(filename, line, column, ErrorTopLevelElementMustBeAList, nil)
 			}
-			if numericType {
+			if opts.DottedPairs && toktxt == dotSymbol {
+				// "."の後ろの要素はリストを閉じるときにtailに移す。
+				if _, ok := dots[lst]; ok || lst.macro != 0 || len(lst.elements) == 0 {
+					return nil, newParseError(filename, line, column, ErrorInvalidDottedPair, nil)
+				}
+				dots[lst] = dottedPair{len(lst.elements), Position{filename, line, column}}
+				break
+			}
+			if opts.NumericType {
 				// IntかFloatとして処理できるか先に確認し、どちらもダメならシンボルにする。
-				vi, err := strconv.ParseInt(toktxt, 0, 64)
-				if err == nil {
-					lst.elements = append(lst.elements, &intElement{vi, Position{filename, line, column}})
-				} else {
-					vf, err := strconv.ParseFloat(toktxt, 64)
-					if err == nil {
-						lst.elements = append(lst.elements, &floatElement{vf, Position{filename, line, column}})
-					} else {
-						lst.elements = append(lst.elements, &symbolIDElement{st.GetSymbolID(toktxt), Position{filename, line, column}})
-					}
+				vi, vf, kind := numeric.parseNumber(toktxt)
+				if kind == intNumber {
+					lst.elements = append(lst.elements, &intElement{vi, Position{filename, line, column}, toktxt})
+					closeReaderMacros(stack)
+					break
 				}
-			} else {
-				lst.elements = append(lst.elements, &symbolIDElement{st.GetSymbolID(toktxt), Position{filename, line, column}})
+				if kind == floatNumber {
+					lst.elements = append(lst.elements, &floatElement{vf, Position{filename, line, column}, toktxt})
+					closeReaderMacros(stack)
+					break
+				}
+			}
+			sym, err := newSymbol(st, toktxt, Position{filename, line, column}, toktxt)
+			if err != nil {
+				return nil, err
 			}
+			lst.elements = append(lst.elements, sym)
+			closeReaderMacros(stack)
 
 		case stringLiteral:
 			lst := stack.peek()
 			if lst == nil {
 				return nil, newParseError(filename, line, column, ErrorTopLevelElementMustBeAList, nil)
 			}
-			if stringAsSymbol {
-				lst.elements = append(lst.elements, &symbolIDElement{st.GetSymbolID(toktxt), Position{filename, line, column}})
+			if opts.StringAsSymbol {
+				sym, err := newSymbol(st, toktxt, Position{filename, line, column}, lexer.rawtext())
+				if err != nil {
+					return nil, err
+				}
+				lst.elements = append(lst.elements, sym)
 			} else {
-				lst.elements = append(lst.elements, &stringElement{toktxt, Position{filename, line, column}})
+				lst.elements = append(lst.elements, &stringElement{toktxt, Position{filename, line, column}, lexer.rawtext(), lexer.textBlock()})
+			}
+			closeReaderMacros(stack)
+
+		case byteString:
+			lst := stack.peek()
+			if lst == nil {
+				return nil, newParseError(filename, line, column, ErrorTopLevelElementMustBeAList, nil)
+			}
+			lst.elements = append(lst.elements, &bytesElement{[]byte(toktxt), Position{filename, line, column}, lexer.rawtext()})
+			closeReaderMacros(stack)
+
+		case quotedSymbol:
+			lst := stack.peek()
+			if lst == nil {
+				return nil, newParseError(filename, line, column, ErrorTopLevelElementMustBeAList, nil)
+			}
+			sym, err := newSymbol(st, toktxt, Position{filename, line, column}, lexer.rawtext())
+			if err != nil {
+				return nil, err
+			}
+			lst.elements = append(lst.elements, sym)
+			closeReaderMacros(stack)
+
+		case charLiteral:
+			lst := stack.peek()
+			if lst == nil {
+				return nil, newParseError(filename, line, column, ErrorTopLevelElementMustBeAList, nil)
+			}
+			r, _ := utf8.DecodeRuneInString(toktxt)
+			lst.elements = append(lst.elements, &charElement{r, Position{filename, line, column}, lexer.rawtext()})
+			closeReaderMacros(stack)
+
+		case datumLabel:
+			lst := stack.peek()
+			index := len(lists)
+			if lst != nil {
+				index = len(lst.elements)
 			}
+			if err := labels.define(toktxt, lst, index, Position{filename, line, column}); err != nil {
+				return nil, err
+			}
+
+		case datumReference:
+			lst := stack.peek()
+			if lst == nil {
+				return nil, newParseError(filename, line, column, ErrorTopLevelElementMustBeAList, nil)
+			}
+			e, err := labels.reference(toktxt, Position{filename, line, column})
+			if err != nil {
+				return nil, err
+			}
+			lst.elements = append(lst.elements, e)
+			closeReaderMacros(stack)
+
+		case listTag:
+			// 字句解析で直後が開くカッコであることを確認している。
+			pos := Position{filename, line, column}
+			if toktxt == "" {
+				// 名前のないタグはシンボルテーブルに登録しない。
+				tag = &symbolIDElement{InvalidSymbolID, pos, ""}
+				break
+			}
+			sym, err := newSymbol(st, toktxt, pos, "")
+			if err != nil {
+				return nil, err
+			}
+			tag = sym
 
 		case commentText:
 
+		case tokQuote, tokQuasiquote, tokUnquote, unquoteSplicing:
+			// 次の要素を読み終えたところでcloseReaderMacros()により閉じられる。
+			lst := stack.peek()
+			pos := Position{filename, line, column}
+			sym, err := newSymbol(st, readerMacroNames[tok], pos, "")
+			if err != nil {
+				return nil, err
+			}
+			lstnew := &ListElement{openchar: tokLeftParenthesis, elements: make([]SyntaxElement, 0, 2), pos: pos, macro: tok}
+			lstnew.elements = append(lstnew.elements, sym)
+			if lst != nil {
+				lst.elements = append(lst.elements, lstnew)
+			} else {
+				lists = append(lists, lstnew)
+			}
+			stack.push(lstnew)
+
 		default:
 			if tok == tokLeftParenthesis || tok == tokLeftSquareBracket || tok == tokLeftCurlyBracket {
 				lst := stack.peek()
-				lstnew := &ListElement{tok, make([]SyntaxElement, 0), Position{filename, line, column}}
+				lstnew := &ListElement{openchar: tok, elements: make([]SyntaxElement, 0), pos: Position{filename, line, column}}
+				if tag != nil {
+					lstnew.tag, lstnew.pos = tag, tag.pos
+					tag = nil
+				}
 				if lst != nil {
 					lst.elements = append(lst.elements, lstnew)
 				} else {
@@ -126,24 +459,45 @@ func Parse(filename string, st *SymbolTable, src io.Reader, numericType bool, st
 				lst := stack.peek()
 				if lst == nil {
 					return nil, newParseError(filename, line, column, ErrorUnexpectedClosingParenthesis, nil)
+				} else if lst.macro != 0 {
+					return nil, newParseError(filename, line, column, ErrorMissingQuotedElement, nil)
 				} else if !lst.isMatchingParen(tok) {
 					return nil, newParseError(filename, line, column, ErrorInconsistencyInClosingBrackets, nil)
 				}
+				if err := closeDottedPair(dots, lst); err != nil {
+					return nil, err
+				}
+				if err := labels.checkClosed(lst); err != nil {
+					return nil, err
+				}
 				stack.pop()
+				closeReaderMacros(stack)
+				if stack.peek() == nil {
+					// ラベルはトップレベルのリストごとに有効。
+					labels = newDatumLabels()
+				}
 			} else if tok != tokTab && tok != tokSpace {
 				return nil, newParseError(filename, line, column, ErrorUnexpectedInputChar, nil)
 			}
 		}
+		labels.bind(lists)
 		tok, line, column, err = lexer.scan()
 	}
 	// lexerのエラー＝字句解析のエラーの場合はパースを途中で止める。
 	if err != io.EOF {
 		return nil, newParseError(filename, line, column, ErrorLexingError, err)
 	}
-	// スタックが空でないということは閉じていないカッコがあるということ。
-	if stack.peek() != nil {
+	// スタックが空でないということは閉じていないカッコかリーダーマクロがあるということ。
+	if lst := stack.peek(); lst != nil {
+		if lst.macro != 0 {
+			return nil, newParseError(filename, line, column, ErrorMissingQuotedElement, nil)
+		}
 		return nil, newParseError(filename, line, column, ErrorMissingClosingParenthesis, nil)
 	}
+	if len(labels.pending) > 0 {
+		p := labels.pending[0]
+		return nil, newParseError(p.pos.Filename, p.pos.Line, p.pos.Column, ErrorMissingLabeledElement, nil)
+	}
 	return lists, nil
 }
 
@@ -152,6 +506,11 @@ func ParseString(filename string, st *SymbolTable, src string, numericType bool,
 	return Parse(filename, st, strings.NewReader(src), numericType, stringAsSymbol)
 }
 
+// ParseStringWithOptions optsに従って文字列をスキャンして*Listの配列を返す。
+func ParseStringWithOptions(filename string, st *SymbolTable, src string, opts ParseOptions) ([]*ListElement, error) {
+	return ParseWithOptions(filename, st, strings.NewReader(src), opts)
+}
+
 func (p Position) String() string {
 	var b bytes.Buffer
 	b.WriteString(p.Filename)
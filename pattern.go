@@ -0,0 +1,146 @@
+package listparser
+
+import "strings"
+
+const (
+	patLiteral  = iota
+	patVariable = iota
+	patList     = iota
+)
+
+const (
+	patternVariablePrefix = "?"
+	patternWildcard       = "_"
+	patternTypeSeparator  = ":"
+)
+
+type patternNode struct {
+	kind     int
+	literal  SyntaxElement
+	name     SymbolID
+	bind     bool
+	typ      func(e SyntaxElement) bool
+	openchar rune
+	children []*patternNode
+}
+
+// Pattern CompilePatternでコンパイルされたパターン
+type Pattern struct {
+	root      *patternNode
+	variables []SymbolID
+}
+
+// CompilePattern srcに書かれたパターンをコンパイルする。
+//
+// パターンは照合するリストと同じ構文で書き、"?"で始まるシンボルは任意の要素に一致する変数になる。
+// "?name:type"のように型(int, float, number, string, symbol, list, bytes, char)を指定すると、その型の要素にだけ一致する。
+// "?_"は一致した要素を束縛しない。それ以外の要素は値とカッコの種類が等しい要素にだけ一致する。
+func CompilePattern(st *SymbolTable, src string) (*Pattern, error) {
+	lists, err := ParseString(src, st, src, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) != 1 {
+		return nil, newParseError(src, 1, 1, ErrorInvalidPattern, nil)
+	}
+	p := &Pattern{variables: make([]SymbolID, 0)}
+	root, err := p.compile(st, lists[0], make(map[SymbolID]bool))
+	if err != nil {
+		return nil, err
+	}
+	p.root = root
+	return p, nil
+}
+
+func (p *Pattern) compile(st *SymbolTable, e SyntaxElement, seen map[SymbolID]bool) (*patternNode, error) {
+	if lst, ok := e.(*ListElement); ok {
+		node := &patternNode{kind: patList, openchar: lst.openchar, children: make([]*patternNode, 0, len(lst.elements))}
+		for _, child := range lst.elements {
+			n, err := p.compile(st, child, seen)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, n)
+		}
+		return node, nil
+	}
+
+	id, ok := e.SymbolValue()
+	if !ok {
+		return &patternNode{kind: patLiteral, literal: e}, nil
+	}
+	name, err := st.GetSymbolName(id)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(name, patternVariablePrefix) {
+		return &patternNode{kind: patLiteral, literal: e}, nil
+	}
+
+	pos := e.Position()
+	name = name[len(patternVariablePrefix):]
+	node := &patternNode{kind: patVariable}
+	if i := strings.Index(name, patternTypeSeparator); i >= 0 {
+		typ, ok := queryTypes[name[i+len(patternTypeSeparator):]]
+		if !ok {
+			return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidPattern, nil)
+		}
+		node.typ = typ
+		name = name[:i]
+	}
+	if name != "" && name != patternWildcard {
+		id, err := newSymbol(st, name, pos, "")
+		if err != nil {
+			return nil, err
+		}
+		node.name = id.value
+		node.bind = true
+		if seen[node.name] {
+			return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorDuplicatePatternVariable, nil)
+		}
+		seen[node.name] = true
+		p.variables = append(p.variables, node.name)
+	}
+	return node, nil
+}
+
+// Variables pに含まれる変数のシンボル（"?"を除いた名前）を出現順に返す。
+func (p *Pattern) Variables() []SymbolID {
+	ids := make([]SymbolID, len(p.variables))
+	copy(ids, p.variables)
+	return ids
+}
+
+// Match eがpに一致するか調べ、一致した場合は変数名のシンボルと要素の対応を返す。
+func (p *Pattern) Match(e SyntaxElement) (map[SymbolID]SyntaxElement, bool) {
+	bindings := make(map[SymbolID]SyntaxElement)
+	if e == nil || !p.root.match(e, bindings) {
+		return nil, false
+	}
+	return bindings, true
+}
+
+func (n *patternNode) match(e SyntaxElement, bindings map[SymbolID]SyntaxElement) bool {
+	switch n.kind {
+	case patVariable:
+		if n.typ != nil && !n.typ(e) {
+			return false
+		}
+		if n.bind {
+			bindings[n.name] = e
+		}
+		return true
+	case patList:
+		lst, ok := e.(*ListElement)
+		if !ok || lst.openchar != n.openchar || len(lst.elements) != len(n.children) || lst.tail != nil || lst.tag != nil {
+			return false
+		}
+		for i, child := range n.children {
+			if !child.match(lst.elements[i], bindings) {
+				return false
+			}
+		}
+		return true
+	}
+	return Equal(n.literal, e)
+}
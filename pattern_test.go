@@ -0,0 +1,92 @@
+package listparser
+
+import "testing"
+
+func TestPattern1(t *testing.T) {
+	st := NewSymbolTable()
+	p, err := CompilePattern(st, `(event ?name goto ?state)`)
+	if err != nil {
+		t.Fatalf("Pattern error with \"%v\"", err)
+	}
+	lists, err := ParseString("TestPattern1", st, `(event test1 goto state1)
+(event test1 goto)
+(event test1 jump state1)
+[event test1 goto state1]`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	b, ok := p.Match(lists[0])
+	if !ok {
+		t.Fatal("Not matched.")
+	}
+	if !IsSymbolID(b[st.GetSymbolID("name")], st.GetSymbolID("test1")) ||
+		!IsSymbolID(b[st.GetSymbolID("state")], st.GetSymbolID("state1")) {
+		t.Error("Unexpected bindings")
+	}
+	for i := 1; i < len(lists); i++ {
+		if _, ok := p.Match(lists[i]); ok {
+			t.Errorf("Matched list %d", i)
+		}
+	}
+	if v := p.Variables(); len(v) != 2 || v[0] != st.GetSymbolID("name") {
+		t.Errorf("Unexpected variables %v", v)
+	}
+}
+
+func TestPatternTypes(t *testing.T) {
+	st := NewSymbolTable()
+	p, err := CompilePattern(st, `(range ?lo:int ?hi:number (?_ "unit" ?u:symbol) 0)`)
+	if err != nil {
+		t.Fatalf("Pattern error with \"%v\"", err)
+	}
+	lists, err := ParseString("TestPatternTypes", st, `(range 1 2.5 (x "unit" m) 0)
+(range 1.0 2 (x "unit" m) 0)
+(range 1 2 (x "unit" "m") 0)
+(range 1 2 (x "unit" m) 1)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	b, ok := p.Match(lists[0])
+	if !ok || len(b) != 3 {
+		t.Fatal("Not matched.")
+	}
+	if v, ok := b[st.GetSymbolID("hi")].FloatValue(); !ok || v != 2.5 {
+		t.Error("Unexpected binding")
+	}
+	for i := 1; i < len(lists); i++ {
+		if _, ok := p.Match(lists[i]); ok {
+			t.Errorf("Matched list %d", i)
+		}
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	st := NewSymbolTable()
+	tests := []struct {
+		src string
+		id  int
+	}{
+		{`(a ?x ?x)`, ErrorDuplicatePatternVariable},
+		{`(a ?x:bool)`, ErrorInvalidPattern},
+		{`(a) (b)`, ErrorInvalidPattern},
+	}
+	for _, test := range tests {
+		_, err := CompilePattern(st, test.src)
+		if pe, ok := err.(*ParseError); !ok || pe.ID != test.id {
+			t.Errorf("Unexpected error \"%v\" for %s", err, test.src)
+		}
+	}
+}
+
+func TestPatternFrozenTable(t *testing.T) {
+	st := NewSymbolTableWithNames("a", "?x", "?y", "y")
+	st.Freeze()
+	if _, err := CompilePattern(st, `(a ?y)`); err != nil {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	_, err := CompilePattern(st, `(a ?x)`)
+	if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorUnknownSymbol {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
@@ -0,0 +1,154 @@
+package listparser
+
+import "fmt"
+
+// PropertyEntry プロパティリストまたは連想リストのキーと値の組
+type PropertyEntry struct {
+	Key        SymbolID
+	KeyElement SyntaxElement
+	Value      SyntaxElement
+}
+
+// PropertyList キーと値の組をソースコード上の順番で保持する。
+type PropertyList struct {
+	entries []PropertyEntry
+	index   map[SymbolID]int
+}
+
+// DuplicateKeyError 同じキーが二回以上現れた。
+type DuplicateKeyError struct {
+	Key    SymbolID
+	First  Position
+	Second Position
+}
+
+func (err *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("%v Duplicate key (first defined at %v)", err.Second, err.First)
+}
+
+func newPropertyList() *PropertyList {
+	return &PropertyList{make([]PropertyEntry, 0), make(map[SymbolID]int)}
+}
+
+func (pl *PropertyList) add(key SyntaxElement, value SyntaxElement) error {
+	id, ok := key.SymbolValue()
+	if !ok {
+		pos := key.Position()
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorPropertyKeyMustBeASymbol, nil)
+	}
+	if i, ok := pl.index[id]; ok {
+		return &DuplicateKeyError{id, pl.entries[i].KeyElement.Position(), key.Position()}
+	}
+	pl.index[id] = len(pl.entries)
+	pl.entries = append(pl.entries, PropertyEntry{id, key, value})
+	return nil
+}
+
+// Plist lstを(key value key value ...)の形のプロパティリストとして読む。
+// キーはシンボルでなければならず、同じキーが二回現れた場合は*DuplicateKeyErrorを返す。
+func (lst *ListElement) Plist() (*PropertyList, error) {
+	pl := newPropertyList()
+	for i := 0; i < len(lst.elements); i += 2 {
+		if i+1 >= len(lst.elements) {
+			pos := lst.elements[i].Position()
+			return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorMissingPropertyValue, nil)
+		}
+		if err := pl.add(lst.elements[i], lst.elements[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return pl, nil
+}
+
+// Alist lstを((key value) (key value) ...)の形の連想リストとして読む。
+// 各要素は二つの要素からなるリストか(key . value)のドット対で、先頭がシンボルでなければならない。
+func (lst *ListElement) Alist() (*PropertyList, error) {
+	pl := newPropertyList()
+	for _, e := range lst.elements {
+		pair, ok := e.(*ListElement)
+		if ok && pair.Len() == 1 && pair.tail != nil {
+			if err := pl.add(pair.elements[0], pair.tail); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !ok || pair.Len() != 2 || pair.tail != nil {
+			pos := e.Position()
+			return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorAssociationMustBeAPair, nil)
+		}
+		if err := pl.add(pair.elements[0], pair.elements[1]); err != nil {
+			return nil, err
+		}
+	}
+	return pl, nil
+}
+
+// Len plのキーと値の組の数を返す。
+func (pl *PropertyList) Len() int {
+	return len(pl.entries)
+}
+
+// EntryAt plのindex番目のキーと値の組をソースコード上の順番で返す。
+func (pl *PropertyList) EntryAt(index int) (PropertyEntry, bool) {
+	if index < 0 || index >= len(pl.entries) {
+		return PropertyEntry{InvalidSymbolID, nil, nil}, false
+	}
+	return pl.entries[index], true
+}
+
+// Entries plのキーと値の組をソースコード上の順番で返す。
+func (pl *PropertyList) Entries() []PropertyEntry {
+	entries := make([]PropertyEntry, len(pl.entries))
+	copy(entries, pl.entries)
+	return entries
+}
+
+// Get キーkeyに対応する値を返す。
+func (pl *PropertyList) Get(key SymbolID) (SyntaxElement, bool) {
+	i, ok := pl.index[key]
+	if !ok {
+		return nil, false
+	}
+	return pl.entries[i].Value, true
+}
+
+// GetInt キーkeyに対応する値がint64ならその値を返す。
+func (pl *PropertyList) GetInt(key SymbolID) (int64, bool) {
+	if v, ok := pl.Get(key); ok {
+		return v.IntValue()
+	}
+	return 0, false
+}
+
+// GetFloat キーkeyに対応する値がfloat64ならその値を返す。
+func (pl *PropertyList) GetFloat(key SymbolID) (float64, bool) {
+	if v, ok := pl.Get(key); ok {
+		return v.FloatValue()
+	}
+	return 0.0, false
+}
+
+// GetString キーkeyに対応する値がstringならその値を返す。
+func (pl *PropertyList) GetString(key SymbolID) (string, bool) {
+	if v, ok := pl.Get(key); ok {
+		return v.StringValue()
+	}
+	return "", false
+}
+
+// GetSymbol キーkeyに対応する値がシンボルならそのSymbolIDを返す。
+func (pl *PropertyList) GetSymbol(key SymbolID) (SymbolID, bool) {
+	if v, ok := pl.Get(key); ok {
+		return v.SymbolValue()
+	}
+	return InvalidSymbolID, false
+}
+
+// GetList キーkeyに対応する値がリストならそのリストを返す。
+func (pl *PropertyList) GetList(key SymbolID) (*ListElement, bool) {
+	if v, ok := pl.Get(key); ok {
+		lst, ok := v.(*ListElement)
+		return lst, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,133 @@
+package listparser
+
+import "testing"
+
+func TestPlist1(t *testing.T) {
+	src := `(port 8080 host "localhost" ratio 0.5 mode fast)`
+	st := NewSymbolTable()
+	lists, err := ParseString("TestPlist1", st, src, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	pl, err := lists[0].Plist()
+	if err != nil {
+		t.Fatalf("Plist error with \"%v\"", err)
+	}
+	if pl.Len() != 4 {
+		t.Errorf("Unexpected number of entries %d", pl.Len())
+	}
+	if v, ok := pl.GetInt(st.GetSymbolID("port")); !ok || v != 8080 {
+		t.Errorf("Unexpected port %d", v)
+	}
+	if v, ok := pl.GetString(st.GetSymbolID("host")); !ok || v != "localhost" {
+		t.Errorf("Unexpected host %s", v)
+	}
+	if v, ok := pl.GetFloat(st.GetSymbolID("ratio")); !ok || v != 0.5 {
+		t.Errorf("Unexpected ratio %f", v)
+	}
+	if v, ok := pl.GetSymbol(st.GetSymbolID("mode")); !ok || v != st.GetSymbolID("fast") {
+		t.Errorf("Unexpected mode %d", v)
+	}
+	if _, ok := pl.GetInt(st.GetSymbolID("host")); ok {
+		t.Error("host is not an int")
+	}
+	if _, ok := pl.Get(st.GetSymbolID("missing")); ok {
+		t.Error("Unexpected entry")
+	}
+
+	keys := []string{"port", "host", "ratio", "mode"}
+	for i, e := range pl.Entries() {
+		if e.Key != st.GetSymbolID(keys[i]) {
+			t.Errorf("Unexpected key at %d", i)
+		}
+	}
+}
+
+func TestAlist1(t *testing.T) {
+	src := `((port 8080) (host "localhost") (tls (cert "a.pem")))`
+	st := NewSymbolTable()
+	lists, err := ParseString("TestAlist1", st, src, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	al, err := lists[0].Alist()
+	if err != nil {
+		t.Fatalf("Alist error with \"%v\"", err)
+	}
+	if v, ok := al.GetInt(st.GetSymbolID("port")); !ok || v != 8080 {
+		t.Errorf("Unexpected port %d", v)
+	}
+	tls, ok := al.GetList(st.GetSymbolID("tls"))
+	if !ok || tls.Len() != 2 {
+		t.Error("Unexpected tls")
+	}
+	e, ok := al.EntryAt(1)
+	if !ok || e.Key != st.GetSymbolID("host") {
+		t.Error("Unexpected entry order")
+	}
+	if _, ok := al.EntryAt(3); ok {
+		t.Error("Unexpected entry")
+	}
+}
+
+func TestPlistErrors(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestPlistErrors", st, `(a 1 b 2 a 3)
+(a 1 b)
+(1 2)
+((a 1) (b 2 3))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	_, err = lists[0].Plist()
+	de, ok := err.(*DuplicateKeyError)
+	if !ok {
+		t.Fatalf("Unexpected error \"%v\"", err)
+	}
+	if de.Key != st.GetSymbolID("a") || de.First.Column != 2 || de.Second.Column != 10 {
+		t.Errorf("Unexpected duplicate key error \"%v\"", de)
+	}
+
+	expected := []struct {
+		index int
+		alist bool
+		id    int
+	}{
+		{1, false, ErrorMissingPropertyValue},
+		{2, false, ErrorPropertyKeyMustBeASymbol},
+		{3, true, ErrorAssociationMustBeAPair},
+	}
+	for _, e := range expected {
+		if e.alist {
+			_, err = lists[e.index].Alist()
+		} else {
+			_, err = lists[e.index].Plist()
+		}
+		pe, ok := err.(*ParseError)
+		if !ok || pe.ID != e.id {
+			t.Errorf("Unexpected error \"%v\" for list %d", err, e.index)
+		}
+	}
+}
+
+func TestAlistDottedPairs(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestAlistDottedPairs", st, `((port . 8080) (host "localhost")) ((port 1 . 2))`, ParseOptions{NumericType: true, DottedPairs: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	al, err := lists[0].Alist()
+	if err != nil {
+		t.Fatalf("Alist error with \"%v\"", err)
+	}
+	if v, ok := al.GetInt(st.GetSymbolID("port")); !ok || v != 8080 {
+		t.Errorf("Unexpected port %d", v)
+	}
+	if v, ok := al.GetString(st.GetSymbolID("host")); !ok || v != "localhost" {
+		t.Errorf("Unexpected host %s", v)
+	}
+	if _, err := lists[1].Alist(); err == nil || err.(*ParseError).ID != ErrorAssociationMustBeAPair {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
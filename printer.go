@@ -0,0 +1,275 @@
+package listparser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// エスケープシーケンスで出力する文字
+var printEscSeq = map[rune]string{
+	'\x07': `\a`,
+	'\x08': `\b`,
+	'\x0c': `\f`,
+	'\x0a': `\n`,
+	'\x0d': `\r`,
+	'\x09': `\t`,
+	'\x0b': `\v`,
+	'\\':   `\\`,
+	'"':    `\"`,
+}
+
+var closingBrackets = map[rune]rune{
+	tokLeftParenthesis:   tokRightParenthesis,
+	tokLeftSquareBracket: tokRightSquareBracket,
+	tokLeftCurlyBracket:  tokRightCurlyBracket,
+}
+
+// quoteString sを文字列リテラルとしてパースできる形式にする。
+// UTF-8として正しくないバイトは\xHHで書き出す。
+func quoteString(s string) string {
+	return quoteText(s, doublequote)
+}
+
+// quoteSymbol シンボル名sを|...|の形式にする。
+func quoteSymbol(s string) string {
+	return quoteText(s, symbolQuote)
+}
+
+func quoteText(s string, quote rune) string {
+	var b bytes.Buffer
+	b.WriteRune(quote)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		} else if r == quote {
+			b.WriteRune(backslash)
+			b.WriteRune(r)
+		} else if r == doublequote {
+			b.WriteRune(r)
+		} else {
+			writeQuotedRune(&b, r)
+		}
+		i += size
+	}
+	b.WriteRune(quote)
+	return b.String()
+}
+
+// allNumericSyntax すべての記法を有効にしたNumericSyntax。
+// どの記法でパースしても数値にならないシンボル名だけをそのまま書き出すために使う。
+var allNumericSyntax = NumericSyntax{HexPrefix: true, OctalPrefix: true, BinaryPrefix: true, DigitSeparators: true, SpecialFloats: true, LeadingPlus: true, HexFloats: true, LeadingZeroOctal: true}
+
+// needsQuote シンボル名sをそのまま書き出すと同じシンボルとして読み込めない場合にtrueを返す。
+// 空の名前、"."、空白やカッコなどの区切りの文字か印字できない文字を含む名前、リーダーマクロの文字を含む名前、
+// '"'か'|'か'#'で始まる名前、いずれかのNumericSyntaxの記法で数値になる名前が該当する。
+func needsQuote(s string) bool {
+	if s == "" || s == dotSymbol || s[0] == doublequote || s[0] == symbolQuote || s[0] == numbersign {
+		return true
+	}
+	for _, r := range s {
+		switch r {
+		case tokTab, tokSpace, semicolon, tokLeftParenthesis, tokLeftSquareBracket, tokLeftCurlyBracket, tokRightParenthesis, tokRightSquareBracket, tokRightCurlyBracket,
+			tokQuote, tokQuasiquote, tokUnquote:
+			return true
+		}
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	_, _, kind := allNumericSyntax.parseNumber(s)
+	return kind != notNumber
+}
+
+// quoteBytes vを#"..."のバイト列リテラルとしてパースできる形式にする。
+// 印字可能なASCII文字以外のバイトは\xHHで書き出す。
+func quoteBytes(v []byte) string {
+	var b bytes.Buffer
+	b.WriteRune(numbersign)
+	b.WriteRune(doublequote)
+	for _, c := range v {
+		if c >= utf8.RuneSelf {
+			fmt.Fprintf(&b, `\x%02x`, c)
+		} else {
+			writeQuotedRune(&b, rune(c))
+		}
+	}
+	b.WriteRune(doublequote)
+	return b.String()
+}
+
+func writeQuotedRune(b *bytes.Buffer, r rune) {
+	if esc, ok := printEscSeq[r]; ok {
+		b.WriteString(esc)
+	} else if r < utf8.RuneSelf && !unicode.IsPrint(r) {
+		fmt.Fprintf(b, `\x%02x`, r)
+	} else if !unicode.IsPrint(r) {
+		fmt.Fprintf(b, `\u{%x}`, r)
+	} else {
+		b.WriteRune(r)
+	}
+}
+
+// formatChar rを文字リテラルとしてパースできる形式にする。
+// 名前のある文字は名前で、印字できない文字と空白は16進数のコードポイントで書き出す。
+func formatChar(r rune) string {
+	for name, v := range charNames {
+		if v == r {
+			return string([]rune{numbersign, charLiteralPrefix}) + name
+		}
+	}
+	if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+		return fmt.Sprintf("%c%c%c%x", numbersign, charLiteralPrefix, charHexPrefix, r)
+	}
+	return string([]rune{numbersign, charLiteralPrefix, r})
+}
+
+// formatFloat vを浮動小数点数としてパースできる形式にする。
+// 無限大と非数はNumericSyntax.SpecialFloatsの記法(inf, -inf, nan)にする。
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	case math.IsNaN(v):
+		return "nan"
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s = s + ".0"
+	}
+	return s
+}
+
+type printer struct {
+	w      *bufio.Writer
+	st     *SymbolTable
+	err    error
+	shared map[*ListElement]bool // 複数の場所から参照されているリスト
+	labels map[*ListElement]int  // 書き出したsharedのリストに付けたデータラベル
+}
+
+// findShared eの中で二回以上現れるリストをsharedに設定する。seenは既に現れたリスト。
+func findShared(e SyntaxElement, seen, shared map[*ListElement]bool) {
+	lst, ok := e.(*ListElement)
+	if !ok {
+		return
+	}
+	if seen[lst] {
+		shared[lst] = true
+		return
+	}
+	seen[lst] = true
+	for _, child := range lst.elements {
+		findShared(child, seen, shared)
+	}
+	if lst.tail != nil {
+		findShared(lst.tail, seen, shared)
+	}
+}
+
+func (p *printer) print(e SyntaxElement) {
+	if p.err != nil {
+		return
+	}
+	// パースした要素は元の綴りのまま書き出す。
+	if raw, ok := Raw(e); ok {
+		p.w.WriteString(raw)
+		return
+	}
+	switch v := e.(type) {
+	case *ListElement:
+		if p.shared[v] {
+			if n, ok := p.labels[v]; ok {
+				fmt.Fprintf(p.w, "%c%d%c", numbersign, n, datumLabelReference)
+				return
+			}
+			n := len(p.labels)
+			p.labels[v] = n
+			fmt.Fprintf(p.w, "%c%d%c", numbersign, n, datumLabelDefine)
+		}
+		if v.macro != 0 && len(v.elements) == 2 {
+			if v.macro == unquoteSplicing {
+				p.w.WriteString(",@")
+			} else {
+				p.w.WriteRune(v.macro)
+			}
+			p.print(v.elements[1])
+			return
+		}
+		if v.tag != nil {
+			name, err := v.tagName(p.st)
+			if err != nil {
+				p.err = err
+				return
+			}
+			p.w.WriteRune(numbersign)
+			p.w.WriteString(name)
+		}
+		p.w.WriteRune(v.openchar)
+		for i, child := range v.elements {
+			if i > 0 {
+				p.w.WriteRune(tokSpace)
+			}
+			p.print(child)
+		}
+		if v.tail != nil {
+			p.w.WriteString(" . ")
+			p.print(v.tail)
+		}
+		p.w.WriteRune(closingBrackets[v.openchar])
+	case *intElement:
+		p.w.WriteString(strconv.FormatInt(v.value, 10))
+	case *floatElement:
+		p.w.WriteString(formatFloat(v.value))
+	case *stringElement:
+		p.w.WriteString(quoteString(v.value))
+	case *bytesElement:
+		p.w.WriteString(quoteBytes(v.value))
+	case *charElement:
+		p.w.WriteString(formatChar(v.value))
+	case *symbolIDElement:
+		name, err := p.st.GetSymbolName(v.value)
+		if err != nil {
+			p.err = err
+			return
+		}
+		if needsQuote(name) {
+			name = quoteSymbol(name)
+		}
+		p.w.WriteString(name)
+	default:
+		p.err = fmt.Errorf("Unexpected element type: %T", e)
+	}
+}
+
+// Fprint eをパースできる形式でwに書き出す。シンボル名はstから取得する。
+// そのままでは読み込めないシンボル名は|...|で書き出すので、読み込むにはParseOptions.QuotedSymbolsが必要になる。
+// 複数の場所から参照されているリストや循環したリストは#0=と#0#のデータラベルで書き出すので、
+// 読み込むにはParseOptions.DatumLabelsが必要になる。
+func Fprint(w io.Writer, st *SymbolTable, e SyntaxElement) error {
+	p := &printer{w: bufio.NewWriter(w), st: st, shared: make(map[*ListElement]bool), labels: make(map[*ListElement]int)}
+	findShared(e, make(map[*ListElement]bool), p.shared)
+	p.print(e)
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+// Sprint eをパースできる形式の文字列にする。
+func Sprint(st *SymbolTable, e SyntaxElement) (string, error) {
+	var b bytes.Buffer
+	if err := Fprint(&b, st, e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
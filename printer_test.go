@@ -0,0 +1,278 @@
+package listparser
+
+import "testing"
+
+func TestSprint1(t *testing.T) {
+	src := `(a 1 -2.5 3.0 "tab\there \"q\" \x01" [b {c}] ())`
+	st := NewSymbolTable()
+	lists, err := ParseString("TestSprint1", st, src, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	s, err := Sprint(st, lists[0])
+	if err != nil {
+		t.Fatalf("Print error with \"%v\"", err)
+	}
+	expected := `(a 1 -2.5 3.0 "tab\there \"q\" \x01" [b {c}] ())`
+	if s != expected {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestSprintReaderMacros(t *testing.T) {
+	src := "('a `(b ,c ,@d))"
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestSprintReaderMacros", st, src, ParseOptions{ReaderMacros: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	s, err := Sprint(st, lists[0])
+	if err != nil {
+		t.Fatalf("Print error with \"%v\"", err)
+	}
+	if s != src {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestSprintRaw(t *testing.T) {
+	src := `(0x10 16 0o20 1.50 "\x41\101" "AA" sym)`
+	st := NewSymbolTable()
+	lists, err := ParseString("TestSprintRaw", st, src, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if raw, ok := Raw(lists[0].ElementAt(0)); !ok || raw != "0x10" {
+		t.Errorf("Unexpected raw text %q", raw)
+	}
+	if raw, ok := Raw(lists[0].ElementAt(4)); !ok || raw != `"\x41\101"` {
+		t.Errorf("Unexpected raw text %q", raw)
+	}
+	if _, ok := Raw(lists[0]); ok {
+		t.Error("List has raw text")
+	}
+	if !Equal(lists[0].ElementAt(0), lists[0].ElementAt(1)) || !Equal(lists[0].ElementAt(4), lists[0].ElementAt(5)) {
+		t.Error("Raw text affects equality")
+	}
+
+	s, err := Sprint(st, lists[0])
+	if err != nil || s != src {
+		t.Errorf("Unexpected result %s", s)
+	}
+
+	// 置き換えた要素は値から書き出す。
+	e := Transform(lists[0], func(path []int, e SyntaxElement) (SyntaxElement, bool) {
+		if v, ok := e.IntValue(); ok && len(path) == 1 && path[0] == 2 {
+			return &intElement{v + 1, e.Position(), ""}, true
+		}
+		return nil, false
+	})
+	s, err = Sprint(st, e)
+	if err != nil || s != `(0x10 16 17 1.50 "\x41\101" "AA" sym)` {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestSprintBytes(t *testing.T) {
+	st := NewSymbolTable()
+	tests := []struct {
+		e        SyntaxElement
+		expected string
+	}{
+		{&stringElement{"a\xffあ\u0085\x01", Position{}, "", nil}, `"a\xffあ\u{85}\x01"`},
+		{&bytesElement{[]byte("a\"\xffあ\n"), Position{}, ""}, `#"a\"\xff\xe3\x81\x82\n"`},
+	}
+	for _, test := range tests {
+		s, err := Sprint(st, test.e)
+		if err != nil || s != test.expected {
+			t.Errorf("Unexpected result %s", s)
+			continue
+		}
+		lists, err := ParseStringWithOptions("TestSprintBytes", st, "("+s+")", ParseOptions{ByteStrings: true})
+		if err != nil || !Equal(lists[0].ElementAt(0), test.e) {
+			t.Errorf("Round trip failed for %s", s)
+		}
+	}
+}
+
+func TestSprintChars(t *testing.T) {
+	st := NewSymbolTable()
+	tests := []struct {
+		r        rune
+		expected string
+	}{
+		{'a', `#\a`},
+		{' ', `#\space`},
+		{'\n', `#\newline`},
+		{'(', `#\(`},
+		{'　', `#\x3000`},
+		{'\u0085', `#\x85`},
+	}
+	for _, test := range tests {
+		s, err := Sprint(st, &charElement{test.r, Position{}, ""})
+		if err != nil || s != test.expected {
+			t.Errorf("Unexpected result %s", s)
+			continue
+		}
+		lists, err := ParseStringWithOptions("TestSprintChars", st, "("+s+")", ParseOptions{CharLiterals: true})
+		if v, ok := lists[0].RuneAt(0); err != nil || !ok || v != test.r {
+			t.Errorf("Round trip failed for %s", s)
+		}
+	}
+}
+
+func TestSprintQuotedSymbols(t *testing.T) {
+	st := NewSymbolTable()
+	names := []string{"plain", "a b", "(x);", "|a", `"a`, "", "12", "-1.5", "tab\there", "a|b", "nan"}
+	lst := &ListElement{openchar: tokLeftParenthesis}
+	for _, name := range names {
+		lst.elements = append(lst.elements, &symbolIDElement{st.GetSymbolID(name), Position{}, ""})
+	}
+	s, err := Sprint(st, lst)
+	if err != nil {
+		t.Fatalf("Print error with \"%v\"", err)
+	}
+	if s != `(plain |a b| |(x);| |\|a| |"a| || |12| |-1.5| |tab\there| a|b |nan|)` {
+		t.Errorf("Unexpected result %s", s)
+	}
+	lists, err := ParseStringWithOptions("TestSprintQuotedSymbols", st, s, ParseOptions{NumericType: true, QuotedSymbols: true})
+	if err != nil || !Equal(lists[0], lst) {
+		t.Errorf("Round trip failed with \"%v\"", err)
+	}
+}
+
+func TestSprintQuotedSymbolsAllOptions(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{NumericType: true, Numeric: &allNumericSyntax, ReaderMacros: true, ByteStrings: true, RawStrings: true,
+		TextBlocks: true, CharLiterals: true, QuotedSymbols: true}
+	names := []string{"a'b", ",x", "`x", `#\a`, `#r"x"`, `#"x"`, "inf", "nan", "+1", "1_000", "0x1p-2", "a#b"}
+	lst := &ListElement{openchar: tokLeftParenthesis}
+	for _, name := range names {
+		lst.elements = append(lst.elements, &symbolIDElement{st.GetSymbolID(name), Position{}, ""})
+	}
+	s, err := Sprint(st, lst)
+	if err != nil {
+		t.Fatalf("Print error with \"%v\"", err)
+	}
+	if s != `(|a'b| |,x| |`+"`"+`x| |#\\a| |#r"x"| |#"x"| |inf| |nan| |+1| |1_000| |0x1p-2| a#b)` {
+		t.Errorf("Unexpected result %s", s)
+	}
+	lists, err := ParseStringWithOptions("TestSprintQuotedSymbolsAllOptions", st, s, opts)
+	if err != nil || len(lists) != 1 || !Equal(lists[0], lst) {
+		t.Errorf("Round trip failed with \"%v\"", err)
+	}
+}
+
+func TestSprintDottedPairs(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{NumericType: true, DottedPairs: true}
+	lists, err := ParseStringWithOptions("TestSprintDottedPairs", st, `(a b . c) [1 . (2 . 3)]`, opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if s, err := Sprint(st, lists[1]); err != nil || s != "[1 . (2 . 3)]" {
+		t.Errorf("Unexpected result %s", s)
+	}
+
+	lst := Clone(lists[0]).(*ListElement)
+	lst.tail = &intElement{1, Position{}, ""}
+	if s, err := Sprint(st, lst); err != nil || s != "(a b . 1)" {
+		t.Errorf("Unexpected result %s", s)
+	}
+	if Equal(lst, lists[0]) || Hash(lst) == Hash(lists[0]) {
+		t.Error("Different tails are equal")
+	}
+	lst.tail = nil
+	if s, err := Sprint(st, lst); err != nil || s != "(a b)" {
+		t.Errorf("Unexpected result %s", s)
+	}
+	if tail, ok := lists[0].Tail(); !ok || !IsSymbolID(tail, st.GetSymbolID("c")) {
+		t.Error("Clone shares the tail")
+	}
+}
+
+func TestSprintDotSymbol(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{DottedPairs: true, QuotedSymbols: true}
+	lst := &ListElement{openchar: tokLeftParenthesis, elements: []SyntaxElement{&symbolIDElement{st.GetSymbolID("a"), Position{}, ""}, &symbolIDElement{st.GetSymbolID(dotSymbol), Position{}, ""}, &symbolIDElement{st.GetSymbolID("b"), Position{}, ""}}}
+	s, err := Sprint(st, lst)
+	if err != nil || s != "(a |.| b)" {
+		t.Errorf("Unexpected result %s", s)
+	}
+	lists, err := ParseStringWithOptions("TestSprintDotSymbol", st, s, opts)
+	if err != nil || !Equal(lists[0], lst) {
+		t.Errorf("Round trip failed with \"%v\"", err)
+	}
+	if _, ok := lists[0].Tail(); ok {
+		t.Error("Quoted dot was read as a dotted pair")
+	}
+}
+
+func TestSprintDatumLabels(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{ReaderMacros: true, DottedPairs: true, DatumLabels: true}
+	for _, src := range []string{"(a #0=(b) #0# #1=(c . #1#))", "#0=(x '#0#)"} {
+		lists, err := ParseStringWithOptions("TestSprintDatumLabels", st, src, opts)
+		if err != nil {
+			t.Fatalf("Parse error with \"%v\"", err)
+		}
+		s, err := Sprint(st, lists[0])
+		if err != nil || s != src {
+			t.Errorf("Unexpected result %s", s)
+		}
+		lists2, err := ParseStringWithOptions("TestSprintDatumLabels", st, s, opts)
+		if err != nil || !Equal(lists[0], lists2[0]) || Hash(lists[0]) != Hash(lists2[0]) {
+			t.Errorf("Round trip failed with \"%v\"", err)
+		}
+	}
+
+	// リスト以外の要素は共有されていてもラベルを付けない。
+	lists, err := ParseStringWithOptions("TestSprintDatumLabels", st, "(#0=a #0#)", opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if s, err := Sprint(st, lists[0]); err != nil || s != "(a a)" {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestSprintDatumLabelSymbols(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{DatumLabels: true, TaggedLists: true, QuotedSymbols: true}
+	lst := &ListElement{openchar: tokLeftParenthesis}
+	for _, name := range []string{"#0#", "#1=", "#name"} {
+		lst.elements = append(lst.elements, &symbolIDElement{st.GetSymbolID(name), Position{}, ""})
+	}
+	s, err := Sprint(st, lst)
+	if err != nil || s != "(|#0#| |#1=| |#name|)" {
+		t.Errorf("Unexpected result %s", s)
+	}
+	lists, err := ParseStringWithOptions("TestSprintDatumLabelSymbols", st, s, opts)
+	if err != nil || !Equal(lists[0], lst) {
+		t.Errorf("Round trip failed with \"%v\"", err)
+	}
+}
+
+func TestSprintTaggedLists(t *testing.T) {
+	st := NewSymbolTable()
+	opts := ParseOptions{NumericType: true, TaggedLists: true}
+	src := `(#(1 2) #[a] #set{x y} (#set{x y}) [a])`
+	lists, err := ParseStringWithOptions("TestSprintTaggedLists", st, src, opts)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if s, err := Sprint(st, lists[0]); err != nil || s != src {
+		t.Errorf("Unexpected result %s", s)
+	}
+	set := lists[0].ElementAt(2)
+	if !Equal(set, lists[0].ElementAt(3).(*ListElement).ElementAt(0)) {
+		t.Error("Same tagged lists are not equal")
+	}
+	plain := &ListElement{openchar: tokLeftCurlyBracket, elements: set.(*ListElement).elements}
+	if Equal(set, plain) || Hash(set) == Hash(plain) {
+		t.Error("Tagged list is equal to a plain list")
+	}
+	if Equal(lists[0].ElementAt(1), lists[0].ElementAt(4)) {
+		t.Error("Vector is equal to a plain list")
+	}
+}
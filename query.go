@@ -0,0 +1,299 @@
+package listparser
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	stepName        = iota
+	stepAny         = iota
+	stepIndex       = iota
+	stepType        = iota
+	stepDescendants = iota
+)
+
+const (
+	queryAny         = "*"
+	queryDescendants = "**"
+	queryTypePrefix  = ":"
+	querySeparator   = "/"
+)
+
+// 型を指定するステップの型名と判定関数
+var queryTypes = map[string]func(e SyntaxElement) bool{
+	"int":    IsInt,
+	"float":  IsFloat,
+	"number": func(e SyntaxElement) bool { return IsInt(e) || IsFloat(e) },
+	"string": IsString,
+	"symbol": IsSymbol,
+	"list":   IsList,
+	"bytes":  IsBytes,
+	"char":   IsChar,
+}
+
+type queryStep struct {
+	kind    int
+	name    SymbolID
+	index   int
+	typ     func(e SyntaxElement) bool
+	pick    int
+	hasPick bool
+}
+
+// Query CompileQueryでコンパイルされたパス式
+type Query struct {
+	steps []queryStep
+}
+
+// QueryResult パス式に一致した要素とその位置
+type QueryResult struct {
+	// Path 検索を始めた要素から見た各階層の添字の並び
+	Path    []int
+	Element SyntaxElement
+}
+
+// CompileQuery パス式exprをコンパイルする。
+//
+// パス式は"/config/server[*]/port"のように"/"で区切ったステップの並びか、
+// "(config server * port)"のようにステップを並べたリストで書く。各ステップは直前のステップで選ばれた要素の子要素から
+//
+//	name    先頭の要素がシンボルnameであるリスト
+//	*       すべての子要素
+//	**      すべての子孫
+//	N       N番目の子要素（負の数の場合は末尾から数える）
+//	:type   型がtype(int, float, number, string, symbol, list, bytes, char)である要素
+//
+// を選ぶ。"name[N]"のように後ろに添字を付けると、そのステップで選ばれた要素のうちN番目だけを選ぶ（"[*]"はすべて）。
+// リストで書く場合は(name N)のように添字をリストで書く。nameの直後の*は"[*]"と同じで、ステップにはならないので、
+// "(config server * port)"は"/config/server[*]/port"と同じになる。nameの後ですべての子要素を選ぶには(* *)と書く。
+func CompileQuery(st *SymbolTable, expr string) (*Query, error) {
+	q := &Query{make([]queryStep, 0)}
+	trimmed := strings.TrimSpace(expr)
+	if strings.HasPrefix(trimmed, string(tokLeftParenthesis)) {
+		lists, err := ParseString(expr, st, trimmed, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(lists) != 1 {
+			return nil, newParseError(expr, 1, 1, ErrorInvalidQuery, nil)
+		}
+		if lists[0].Len() == 0 {
+			return nil, newParseError(expr, 1, 1, ErrorInvalidQuery, nil)
+		}
+		for _, e := range lists[0].elements {
+			if n := len(q.steps); n > 0 && q.steps[n-1].kind == stepName && !q.steps[n-1].hasPick && IsSymbolID(e, lookupSymbolID(st, queryAny)) {
+				// nameの直後の*は"name[*]"と同じ
+				continue
+			}
+			step, err := compileListStep(st, expr, e)
+			if err != nil {
+				return nil, err
+			}
+			q.steps = append(q.steps, step)
+		}
+		return q, nil
+	}
+
+	column := 1
+	for i, s := range strings.Split(trimmed, querySeparator) {
+		if s == "" && i == 0 {
+			column += len(querySeparator)
+			continue
+		}
+		step, err := compileStep(st, s, Position{expr, 1, column})
+		if err != nil {
+			return nil, err
+		}
+		q.steps = append(q.steps, step)
+		column += len(s) + len(querySeparator)
+	}
+	if len(q.steps) == 0 {
+		return nil, newParseError(expr, 1, 1, ErrorInvalidQuery, nil)
+	}
+	return q, nil
+}
+
+// compileStep "name[N]"の形のステップをコンパイルする。posはエラーの位置。
+func compileStep(st *SymbolTable, s string, pos Position) (queryStep, error) {
+	if i := strings.IndexRune(s, tokLeftSquareBracket); i >= 0 || strings.ContainsRune(s, tokRightSquareBracket) {
+		if i < 0 || !strings.HasSuffix(s, string(tokRightSquareBracket)) || strings.ContainsRune(s[:len(s)-1], tokRightSquareBracket) {
+			return queryStep{}, newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidQuery, nil)
+		}
+		step, err := compileAtomStep(st, s[:i], pos)
+		if err != nil {
+			return step, err
+		}
+		pick := s[i+1 : len(s)-1]
+		if pick == queryAny {
+			return step, nil
+		}
+		n, err := strconv.Atoi(pick)
+		if err != nil {
+			return step, newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidQuery, nil)
+		}
+		step.pick = n
+		step.hasPick = true
+		return step, nil
+	}
+	return compileAtomStep(st, s, pos)
+}
+
+func compileAtomStep(st *SymbolTable, s string, pos Position) (queryStep, error) {
+	invalid := newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidQuery, nil)
+	switch {
+	case s == "":
+		return queryStep{}, invalid
+	case s == queryAny:
+		return queryStep{kind: stepAny}, nil
+	case s == queryDescendants:
+		return queryStep{kind: stepDescendants}, nil
+	case strings.HasPrefix(s, queryTypePrefix):
+		typ, ok := queryTypes[s[len(queryTypePrefix):]]
+		if !ok {
+			return queryStep{}, invalid
+		}
+		return queryStep{kind: stepType, typ: typ}, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return queryStep{kind: stepIndex, index: n}, nil
+	}
+	// パースする前にコンパイルしてもいいように、シンボルはテーブルに登録しておく。
+	name, err := newSymbol(st, s, pos, "")
+	if err != nil {
+		return queryStep{}, err
+	}
+	return queryStep{kind: stepName, name: name.value}, nil
+}
+
+// compileListStep リストで書かれたパス式の一つのステップをコンパイルする。
+func compileListStep(st *SymbolTable, expr string, e SyntaxElement) (queryStep, error) {
+	pos := e.Position()
+	pos.Filename = expr
+	invalid := newParseError(expr, pos.Line, pos.Column, ErrorInvalidQuery, nil)
+	if n, ok := e.IntValue(); ok {
+		return queryStep{kind: stepIndex, index: int(n)}, nil
+	}
+	if id, ok := e.SymbolValue(); ok {
+		name, err := st.GetSymbolName(id)
+		if err != nil {
+			return queryStep{}, err
+		}
+		return compileAtomStep(st, name, pos)
+	}
+	if lst, ok := e.(*ListElement); ok && lst.Len() == 2 {
+		step, err := compileListStep(st, expr, lst.elements[0])
+		if err != nil {
+			return step, err
+		}
+		if n, ok := lst.IntAt(1); ok {
+			step.pick = int(n)
+			step.hasPick = true
+			return step, nil
+		} else if id, ok := lst.SymbolAt(1); ok && id == lookupSymbolID(st, queryAny) {
+			return step, nil
+		}
+	}
+	return queryStep{}, invalid
+}
+
+func (step *queryStep) matches(e SyntaxElement) bool {
+	switch step.kind {
+	case stepName:
+		lst, ok := e.(*ListElement)
+		return ok && lst.Len() > 0 && IsSymbolID(lst.elements[0], step.name)
+	case stepType:
+		return step.typ(e)
+	}
+	return true
+}
+
+// apply rに対してステップを適用した結果をresultsに追加する。
+func (step *queryStep) apply(r QueryResult, results []QueryResult) []QueryResult {
+	lst, ok := r.Element.(*ListElement)
+	if !ok {
+		return results
+	}
+	matched := make([]QueryResult, 0)
+	switch step.kind {
+	case stepIndex:
+		i := step.index
+		if i < 0 {
+			i += len(lst.elements)
+		}
+		if i >= 0 && i < len(lst.elements) {
+			matched = append(matched, QueryResult{appendPath(r.Path, i), lst.elements[i]})
+		}
+	case stepDescendants:
+		Walk(lst, func(path []int, e SyntaxElement) WalkAction {
+			if len(path) > 0 {
+				matched = append(matched, QueryResult{appendPath(r.Path, path...), e})
+			}
+			return WalkContinue
+		})
+	default:
+		for i, e := range lst.elements {
+			if step.matches(e) {
+				matched = append(matched, QueryResult{appendPath(r.Path, i), e})
+			}
+		}
+	}
+	if !step.hasPick {
+		return append(results, matched...)
+	}
+	i := step.pick
+	if i < 0 {
+		i += len(matched)
+	}
+	if i >= 0 && i < len(matched) {
+		results = append(results, matched[i])
+	}
+	return results
+}
+
+func appendPath(path []int, indexes ...int) []int {
+	p := make([]int, len(path), len(path)+len(indexes))
+	copy(p, path)
+	return append(p, indexes...)
+}
+
+// Select rootを起点にパス式に一致する要素を返す。最初のステップはroot自身に対して適用される。
+func (q *Query) Select(root SyntaxElement) []QueryResult {
+	results := q.selectFrom(&ListElement{openchar: tokLeftParenthesis, elements: []SyntaxElement{root}})
+	for i := range results {
+		results[i].Path = results[i].Path[1:]
+	}
+	return results
+}
+
+// SelectAll Parseが返したトップレベルのリストの並びを起点にパス式に一致する要素を返す。
+// 最初のステップはトップレベルのリストに対して適用され、Pathの最初の添字はlistsの添字になる。
+func (q *Query) SelectAll(lists []*ListElement) []QueryResult {
+	root := &ListElement{openchar: tokLeftParenthesis, elements: make([]SyntaxElement, len(lists))}
+	for i, lst := range lists {
+		root.elements[i] = lst
+	}
+	return q.selectFrom(root)
+}
+
+// selectFrom 起点の要素を子要素に持つ仮のリストrootからステップを順に適用する。
+func (q *Query) selectFrom(root *ListElement) []QueryResult {
+	results := []QueryResult{{make([]int, 0), root}}
+	for i := range q.steps {
+		next := make([]QueryResult, 0)
+		for _, r := range results {
+			next = q.steps[i].apply(r, next)
+		}
+		results = next
+	}
+	return results
+}
+
+// Find パス式exprをコンパイルしてrootを起点に一致する要素を返す。
+func Find(st *SymbolTable, root SyntaxElement, expr string) ([]QueryResult, error) {
+	q, err := CompileQuery(st, expr)
+	if err != nil {
+		return nil, err
+	}
+	return q.Select(root), nil
+}
@@ -0,0 +1,113 @@
+package listparser
+
+import (
+	"fmt"
+	"testing"
+)
+
+var querysrc = `(config
+  (server (host "a") (port 80))
+  (server (host "b") (port 8080) (tls on))
+  (client (port 1)))
+(other (port 2))`
+
+func TestQuery1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestQuery1", st, querysrc, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	tests := []struct {
+		expr   string
+		values []int64
+		paths  string
+	}{
+		{"/config/server[*]/port/1", []int64{80, 8080}, "[[0 1 2 1] [0 2 2 1]]"},
+		{"(config server port 1)", []int64{80, 8080}, "[[0 1 2 1] [0 2 2 1]]"},
+		{"(config server * port 1)", []int64{80, 8080}, "[[0 1 2 1] [0 2 2 1]]"},
+		{"(config (* *) port 1)", []int64{80, 8080, 1}, "[[0 1 2 1] [0 2 2 1] [0 3 1 1]]"},
+		{"config/server[1]/port/-1", []int64{8080}, "[[0 2 2 1]]"},
+		{"(config (server -1) port 1)", []int64{8080}, "[[0 2 2 1]]"},
+		{"/config/*/port/:int", []int64{80, 8080, 1}, "[[0 1 2 1] [0 2 2 1] [0 3 1 1]]"},
+		{"/**/port/:number", []int64{80, 8080, 1, 2}, "[[0 1 2 1] [0 2 2 1] [0 3 1 1] [1 1 1]]"},
+		{"/config/server/tls/:int", []int64{}, "[]"},
+		{"/config/unknown", []int64{}, "[]"},
+	}
+	for _, test := range tests {
+		q, err := CompileQuery(st, test.expr)
+		if err != nil {
+			t.Errorf("Query error with \"%v\"", err)
+			continue
+		}
+		results := q.SelectAll(lists)
+		paths := make([][]int, 0)
+		for i, r := range results {
+			paths = append(paths, r.Path)
+			if v, ok := r.Element.IntValue(); !ok || i >= len(test.values) || v != test.values[i] {
+				t.Errorf("Unexpected result %v for %s", r.Element, test.expr)
+			}
+		}
+		if len(results) != len(test.values) || fmt.Sprint(paths) != test.paths {
+			t.Errorf("Unexpected paths %v for %s", paths, test.expr)
+		}
+	}
+}
+
+func TestFind1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestFind1", st, querysrc, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	results, err := Find(st, lists[0], "/config/server/host/:string")
+	if err != nil {
+		t.Fatalf("Query error with \"%v\"", err)
+	}
+	if len(results) != 2 || fmt.Sprint(results[1].Path) != "[2 1 1]" {
+		t.Errorf("Unexpected results %v", results)
+	}
+	if s, ok := results[1].Element.StringValue(); !ok || s != "b" {
+		t.Errorf("Unexpected value %s", s)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	st := NewSymbolTable()
+	for _, expr := range []string{"", "/", "/a//b", "/a/:bool", "/a[x]", "/a[x", "/a]", "/a[1]]", "(a \"b\")", "()"} {
+		if _, err := CompileQuery(st, expr); err == nil {
+			t.Errorf("No error for \"%s\"", expr)
+		}
+	}
+}
+
+func TestQueryBeforeParse(t *testing.T) {
+	st := NewSymbolTable()
+	q, err := CompileQuery(st, "/config/client/port/1")
+	if err != nil {
+		t.Fatalf("Query error with \"%v\"", err)
+	}
+	lists, err := ParseString("TestQueryBeforeParse", st, querysrc, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	results := q.SelectAll(lists)
+	if len(results) != 1 {
+		t.Fatalf("Unexpected results %v", results)
+	}
+	if v, ok := results[0].Element.IntValue(); !ok || v != 1 {
+		t.Errorf("Unexpected value %d", v)
+	}
+}
+
+func TestQueryFrozenTable(t *testing.T) {
+	st := NewSymbolTableWithNames("config")
+	st.Freeze()
+	if _, err := CompileQuery(st, "/config/*"); err != nil {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	_, err := CompileQuery(st, "/config/client")
+	if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorUnknownSymbol || pe.ErrorLocation.Column != 9 {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
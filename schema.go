@@ -0,0 +1,304 @@
+package listparser
+
+import (
+	"errors"
+	"strings"
+)
+
+const schemaKeyword = "schema"
+
+// スキーマの名前と型の後ろに付けて出現回数を指定する記号
+const (
+	schemaOptional   = "?"
+	schemaZeroOrMore = "*"
+	schemaOneOrMore  = "+"
+)
+
+const unbounded = -1
+
+// ViolationKind スキーマ違反の種類
+type ViolationKind int
+
+const (
+	// ViolationMissingField 必要なフィールドがない。
+	ViolationMissingField ViolationKind = iota
+	// ViolationUnknownField スキーマにないフィールドがある。
+	ViolationUnknownField
+	// ViolationTooManyFields フィールドが指定された回数より多く現れた。
+	ViolationTooManyFields
+	// ViolationMissingValue 必要な値がない。
+	ViolationMissingValue
+	// ViolationTypeMismatch 値の型がスキーマと異なる。
+	ViolationTypeMismatch
+	// ViolationUnexpectedElement フィールドでも値でもない要素がある。
+	ViolationUnexpectedElement
+)
+
+var violationMessages = map[ViolationKind]string{
+	ViolationMissingField:      "Missing field:",
+	ViolationUnknownField:      "Unknown field:",
+	ViolationTooManyFields:     "Too many fields:",
+	ViolationMissingValue:      "Missing value:",
+	ViolationTypeMismatch:      "Type mismatch: expected",
+	ViolationUnexpectedElement: "Unexpected element",
+}
+
+// Violation 構文木がスキーマに従っていない箇所
+type Violation struct {
+	Position Position
+	Kind     ViolationKind
+	// Detail フィールド名または期待する型の名前
+	Detail string
+}
+
+func (v Violation) Error() string {
+	m := violationMessages[v.Kind]
+	if v.Detail != "" {
+		m += " " + v.Detail
+	}
+	return v.Position.String() + " " + m
+}
+
+type schemaValue struct {
+	typeName string
+	typ      func(e SyntaxElement) bool
+	min, max int
+}
+
+type schemaRecord struct {
+	name      SymbolID
+	label     string
+	min, max  int
+	values    []schemaValue
+	fields    []*schemaRecord
+	fieldByID map[SymbolID]*schemaRecord
+}
+
+// Schema リストの形を宣言したスキーマ
+type Schema struct {
+	st   *SymbolTable
+	root *schemaRecord
+}
+
+// NewSchema (schema decl...)の形のリストlstからSchemaを作る。
+//
+// declは(name member...)の形で、先頭の要素がシンボルnameであるリストを表す。
+// memberは型の名前(int, float, number, string, symbol, bytes, char, bool, list, any)か、子要素のリストを表すdeclである。
+// 型は先頭の要素に続く値を順に表し、declは値の後ろに任意の順で並ぶ子要素のリストを表す。
+// boolはシンボルtrueとfalseに一致する。
+//
+// nameと型の名前の後ろには出現回数を付けることができる。"?"は0か1回、"*"は0回以上、"+"は1回以上で、
+// 付けない場合はちょうど1回になる。
+//
+//	(schema (server (port int) (host string) (tls? bool) (alias* string+)))
+func NewSchema(st *SymbolTable, lst *ListElement) (*Schema, error) {
+	if lst.Len() == 0 || !IsSymbolID(lst.elements[0], lookupSymbolID(st, schemaKeyword)) {
+		return nil, newParseError(lst.pos.Filename, lst.pos.Line, lst.pos.Column, ErrorInvalidSchema, nil)
+	}
+	s := &Schema{st: st}
+	s.root = &schemaRecord{min: 1, max: 1, fieldByID: make(map[SymbolID]*schemaRecord)}
+	for _, e := range lst.elements[1:] {
+		if err := s.compileField(s.root, e); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ParseSchema srcをパースしてSchemaを作る。srcは(schema ...)のリストを一つだけ含まなければならない。
+func ParseSchema(filename string, st *SymbolTable, src string) (*Schema, error) {
+	lists, err := ParseString(filename, st, src, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) != 1 {
+		return nil, newParseError(filename, 1, 1, ErrorInvalidSchema, nil)
+	}
+	return NewSchema(st, lists[0])
+}
+
+// splitOccurrence nameの後ろの出現回数の記号を取り除き、最小と最大の出現回数を返す。
+func splitOccurrence(name string) (string, int, int) {
+	if len(name) > 1 {
+		switch {
+		case strings.HasSuffix(name, schemaOptional):
+			return name[:len(name)-1], 0, 1
+		case strings.HasSuffix(name, schemaZeroOrMore):
+			return name[:len(name)-1], 0, unbounded
+		case strings.HasSuffix(name, schemaOneOrMore):
+			return name[:len(name)-1], 1, unbounded
+		}
+	}
+	return name, 1, 1
+}
+
+func (s *Schema) compileField(parent *schemaRecord, e SyntaxElement) error {
+	pos := e.Position()
+	lst, ok := e.(*ListElement)
+	if !ok || lst.Len() == 0 || !IsSymbol(lst.elements[0]) {
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidSchema, nil)
+	}
+	id, _ := lst.elements[0].SymbolValue()
+	name, err := s.st.GetSymbolName(id)
+	if err != nil {
+		return err
+	}
+	r := &schemaRecord{fieldByID: make(map[SymbolID]*schemaRecord)}
+	r.label, r.min, r.max = splitOccurrence(name)
+	sym, err := newSymbol(s.st, r.label, pos, "")
+	if err != nil {
+		return err
+	}
+	r.name = sym.value
+	if _, ok := parent.fieldByID[r.name]; ok {
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidSchema, errors.New(r.label))
+	}
+	for _, member := range lst.elements[1:] {
+		if IsList(member) {
+			if err := s.compileField(r, member); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.compileValue(r, member); err != nil {
+			return err
+		}
+	}
+	parent.fields = append(parent.fields, r)
+	parent.fieldByID[r.name] = r
+	return nil
+}
+
+func (s *Schema) compileValue(r *schemaRecord, e SyntaxElement) error {
+	pos := e.Position()
+	id, ok := e.SymbolValue()
+	if !ok {
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidSchema, nil)
+	}
+	name, err := s.st.GetSymbolName(id)
+	if err != nil {
+		return err
+	}
+	v := schemaValue{}
+	v.typeName, v.min, v.max = splitOccurrence(name)
+	v.typ = s.valueType(v.typeName)
+	if v.typ == nil {
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidSchema, errors.New(v.typeName))
+	}
+	if len(r.fields) > 0 {
+		// 値はフィールドより前に書かなければならない。
+		return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidSchema, errors.New(v.typeName))
+	}
+	r.values = append(r.values, v)
+	return nil
+}
+
+func (s *Schema) valueType(name string) func(e SyntaxElement) bool {
+	switch name {
+	case "bool":
+		// スキーマより後にパースした要素のtrueとfalseにも一致するように、調べるときに探す。
+		return func(e SyntaxElement) bool {
+			return IsSymbolID(e, lookupSymbolID(s.st, "true")) || IsSymbolID(e, lookupSymbolID(s.st, "false"))
+		}
+	case "any":
+		return func(e SyntaxElement) bool { return true }
+	}
+	return queryTypes[name]
+}
+
+// Validate listsがスキーマに従っているか調べ、すべての違反を返す。
+// listsの各要素はスキーマのdeclのいずれかに一致しなければならない。
+func (s *Schema) Validate(lists []*ListElement) []Violation {
+	pos := Position{}
+	elements := make([]SyntaxElement, len(lists))
+	for i, lst := range lists {
+		elements[i] = lst
+	}
+	if len(lists) > 0 {
+		pos = Position{lists[0].pos.Filename, 1, 1}
+	}
+	return s.validateFields(make([]Violation, 0), s.root, pos, elements)
+}
+
+// ValidateList lstがスキーマの先頭の要素が等しいdeclに従っているか調べ、すべての違反を返す。
+func (s *Schema) ValidateList(lst *ListElement) []Violation {
+	violations := make([]Violation, 0)
+	if r := s.fieldOf(s.root, lst); r != nil {
+		return s.validateRecord(violations, r, lst)
+	}
+	return s.unexpected(violations, lst)
+}
+
+// fieldOf lstの先頭の要素が名前であるrのフィールドを返す。
+func (s *Schema) fieldOf(r *schemaRecord, lst *ListElement) *schemaRecord {
+	if lst.Len() == 0 {
+		return nil
+	}
+	id, ok := lst.elements[0].SymbolValue()
+	if !ok {
+		return nil
+	}
+	return r.fieldByID[id]
+}
+
+func (s *Schema) unexpected(violations []Violation, e SyntaxElement) []Violation {
+	if lst, ok := e.(*ListElement); ok && lst.Len() > 0 {
+		if id, ok := lst.elements[0].SymbolValue(); ok {
+			name, _ := s.st.GetSymbolName(id)
+			return append(violations, Violation{e.Position(), ViolationUnknownField, name})
+		}
+	}
+	return append(violations, Violation{e.Position(), ViolationUnexpectedElement, ""})
+}
+
+func (s *Schema) validateRecord(violations []Violation, r *schemaRecord, lst *ListElement) []Violation {
+	elements := lst.elements[1:]
+	i := 0
+	for _, v := range r.values {
+		count := 0
+		for i < len(elements) && (v.max == unbounded || count < v.max) && v.typ(elements[i]) {
+			i++
+			count++
+		}
+		if count >= v.min {
+			continue
+		}
+		if i == len(elements) {
+			violations = append(violations, Violation{lst.pos, ViolationMissingValue, v.typeName})
+			continue
+		}
+		violations = append(violations, Violation{elements[i].Position(), ViolationTypeMismatch, v.typeName})
+		// フィールドでなければ型の違う値として読み飛ばす。
+		if sub, ok := elements[i].(*ListElement); !ok || s.fieldOf(r, sub) == nil {
+			i++
+		}
+	}
+	return s.validateFields(violations, r, lst.pos, elements[i:])
+}
+
+func (s *Schema) validateFields(violations []Violation, r *schemaRecord, pos Position, elements []SyntaxElement) []Violation {
+	counts := make(map[*schemaRecord]int)
+	for _, e := range elements {
+		sub, ok := e.(*ListElement)
+		if !ok {
+			violations = s.unexpected(violations, e)
+			continue
+		}
+		f := s.fieldOf(r, sub)
+		if f == nil {
+			violations = s.unexpected(violations, e)
+			continue
+		}
+		counts[f]++
+		if f.max != unbounded && counts[f] > f.max {
+			violations = append(violations, Violation{e.Position(), ViolationTooManyFields, f.label})
+		}
+		violations = s.validateRecord(violations, f, sub)
+	}
+	for _, f := range r.fields {
+		if counts[f] < f.min {
+			violations = append(violations, Violation{pos, ViolationMissingField, f.label})
+		}
+	}
+	return violations
+}
@@ -0,0 +1,138 @@
+package listparser
+
+import "testing"
+
+const testSchema = `(schema
+  (server* string?
+    (port int)
+    (host string)
+    (tls? bool)
+    (alias* string+)
+    (limits? (rate number) (burst? int))))`
+
+func TestSchemaValid(t *testing.T) {
+	st := NewSymbolTable()
+	s, err := ParseSchema("schema.lsp", st, testSchema)
+	if err != nil {
+		t.Fatalf("Schema error with \"%v\"", err)
+	}
+	lists, err := ParseString("server.lsp", st, `
+(server "main" (host "example.com") (port 80) (alias "a" "b") (alias "c") (limits (rate 1.5)))
+(server (port 8080) (host "localhost") (tls true))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v := s.Validate(lists); len(v) != 0 {
+		t.Errorf("Unexpected violations %v", v)
+	}
+	if v := s.ValidateList(lists[1]); len(v) != 0 {
+		t.Errorf("Unexpected violations %v", v)
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	st := NewSymbolTable()
+	s, err := ParseSchema("schema.lsp", st, testSchema)
+	if err != nil {
+		t.Fatalf("Schema error with \"%v\"", err)
+	}
+	lists, err := ParseString("server.lsp", st, `(server 1
+  (port "80")
+  (tls yes)
+  (tls false)
+  (alias)
+  (debug)
+  (limits (rate)))
+(foo)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	expected := []Violation{
+		{Position{"server.lsp", 1, 9}, ViolationUnexpectedElement, ""},
+		{Position{"server.lsp", 2, 9}, ViolationTypeMismatch, "int"},
+		{Position{"server.lsp", 3, 8}, ViolationTypeMismatch, "bool"},
+		{Position{"server.lsp", 4, 3}, ViolationTooManyFields, "tls"},
+		{Position{"server.lsp", 5, 3}, ViolationMissingValue, "string"},
+		{Position{"server.lsp", 6, 3}, ViolationUnknownField, "debug"},
+		{Position{"server.lsp", 7, 11}, ViolationMissingValue, "number"},
+		{Position{"server.lsp", 1, 1}, ViolationMissingField, "host"},
+		{Position{"server.lsp", 8, 1}, ViolationUnknownField, "foo"},
+	}
+	violations := s.Validate(lists)
+	if len(violations) != len(expected) {
+		t.Fatalf("Unexpected violations %v", violations)
+	}
+	for i, v := range violations {
+		if v != expected[i] {
+			t.Errorf("Expected %v but %v", expected[i], v)
+		}
+	}
+	if violations[1].Error() != "server.lsp:2:9 Type mismatch: expected int" {
+		t.Errorf("Unexpected message %q", violations[1].Error())
+	}
+}
+
+func TestSchemaMissingTopLevel(t *testing.T) {
+	st := NewSymbolTable()
+	s, err := ParseSchema("schema.lsp", st, `(schema (server+ (port int)) (client? symbol))`)
+	if err != nil {
+		t.Fatalf("Schema error with \"%v\"", err)
+	}
+	lists, err := ParseString("client.lsp", st, `(client a)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	violations := s.Validate(lists)
+	if len(violations) != 1 || violations[0] != (Violation{Position{"client.lsp", 1, 1}, ViolationMissingField, "server"}) {
+		t.Errorf("Unexpected violations %v", violations)
+	}
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	tests := []struct {
+		src string
+		pos Position
+	}{
+		{`(server (port int))`, Position{"schema.lsp", 1, 1}},
+		{`(schema server)`, Position{"schema.lsp", 1, 9}},
+		{`(schema (server (port integer)))`, Position{"schema.lsp", 1, 23}},
+		{`(schema (server (port int) (port string)))`, Position{"schema.lsp", 1, 28}},
+		{`(schema (server (port int) string))`, Position{"schema.lsp", 1, 28}},
+		{`(schema (server 1))`, Position{"schema.lsp", 1, 17}},
+		{`(schema) (schema)`, Position{"schema.lsp", 1, 1}},
+	}
+	for _, test := range tests {
+		_, err := ParseSchema("schema.lsp", NewSymbolTable(), test.src)
+		perr, ok := err.(*ParseError)
+		if !ok || perr.ID != ErrorInvalidSchema || perr.ErrorLocation != test.pos {
+			t.Errorf("Unexpected error \"%v\" for %q", err, test.src)
+		}
+	}
+}
+
+func TestSchemaFrozenTable(t *testing.T) {
+	names := []string{"schema", "server", "port", "int", "tls?", "bool", "tls", "true"}
+	st := NewSymbolTableWithNames(names...)
+	st.Freeze()
+	s, err := ParseSchema("schema.lsp", st, `(schema (server (port int) (tls? bool)))`)
+	if err != nil {
+		t.Fatalf("Schema error with \"%v\"", err)
+	}
+	if st.Len() != len(names) {
+		t.Errorf("Unexpected symbols %d", st.Len())
+	}
+	lists, err := ParseString("server.lsp", st, `(server (port 1) (tls true))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	if v := s.Validate(lists); len(v) != 0 {
+		t.Errorf("Unexpected violations %v", v)
+	}
+
+	st = NewSymbolTableWithNames("schema", "server", "tls?", "bool")
+	st.Freeze()
+	_, err = ParseSchema("schema.lsp", st, `(schema (server (tls? bool)))`)
+	if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorUnknownSymbol || pe.ErrorLocation != (Position{"schema.lsp", 1, 17}) {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
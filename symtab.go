@@ -0,0 +1,113 @@
+package listparser
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// NewSymbolTableWithNames namesの順にIDを割り当てたSymbolTableを作る。
+func NewSymbolTableWithNames(names ...string) *SymbolTable {
+	st := NewSymbolTable()
+	for _, name := range names {
+		st.GetSymbolID(name)
+	}
+	return st
+}
+
+// LookupSymbolID シンボルnameのIDを返す。IDが割り当てられていない場合は新たに割り当てずにfalseを返す。
+func (st *SymbolTable) LookupSymbolID(name string) (SymbolID, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	id, ok := st.symbolMap[name]
+	if !ok {
+		return InvalidSymbolID, false
+	}
+	return id, true
+}
+
+// lookupSymbolID シンボルnameのIDを返す。登録されていない場合はどのシンボルとも一致しないInvalidSymbolIDを返す。
+// リストを調べるだけでシンボルを作らない場合に使う。
+func lookupSymbolID(st *SymbolTable, name string) SymbolID {
+	id, _ := st.LookupSymbolID(name)
+	return id
+}
+
+// Len stに登録されているシンボルの数を返す。
+func (st *SymbolTable) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.names)
+}
+
+// symbolNames stのシンボル名をIDの順に返す。
+func (st *SymbolTable) symbolNames() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	names := make([]string, len(st.names))
+	copy(names, st.names)
+	return names
+}
+
+// Freeze 以降、stに新しいシンボルを登録しないようにする。
+// Freezeされたテーブルを使ってパースすると、登録されていないシンボルはErrorUnknownSymbolになる。
+func (st *SymbolTable) Freeze() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.frozen = true
+}
+
+// IsFrozen stがFreezeされているか調べる。
+func (st *SymbolTable) IsFrozen() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.frozen
+}
+
+// Merge otherのシンボルをstに登録し、otherのIDからstのIDへの対応を返す。
+// stがFreezeされている場合、stに登録されていないシンボルは対応に含まれない。
+func (st *SymbolTable) Merge(other *SymbolTable) map[SymbolID]SymbolID {
+	remap := make(map[SymbolID]SymbolID)
+	for i, name := range other.symbolNames() {
+		if id := st.GetSymbolID(name); id != InvalidSymbolID {
+			remap[SymbolID(i)] = id
+		}
+	}
+	return remap
+}
+
+// MarshalText stのシンボル名をIDの順に一行に一つずつ、Goの文字列リテラルの形式で書き出す。
+func (st *SymbolTable) MarshalText() ([]byte, error) {
+	var b bytes.Buffer
+	for _, name := range st.symbolNames() {
+		b.WriteString(strconv.Quote(name))
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalText MarshalTextで書き出したシンボル名を読み込み、stの内容を置き換える。
+// 空行は無視する。
+func (st *SymbolTable) UnmarshalText(text []byte) error {
+	symbolMap := make(map[string]SymbolID)
+	names := make([]string, 0)
+	for _, line := range bytes.Split(text, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		name, err := strconv.Unquote(string(line))
+		if err != nil {
+			return err
+		}
+		if _, ok := symbolMap[name]; ok {
+			return ErrorDuplicateSymbol
+		}
+		symbolMap[name] = SymbolID(len(names))
+		names = append(names, name)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.symbolMap = symbolMap
+	st.names = names
+	return nil
+}
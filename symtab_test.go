@@ -0,0 +1,89 @@
+package listparser
+
+import "testing"
+
+func TestSymbolTableText(t *testing.T) {
+	st := NewSymbolTableWithNames("a", "b c", "d\ne", "")
+	if st.Len() != 4 || st.GetSymbolID("b c") != 1 || st.GetSymbolID("") != 3 {
+		t.Fatal("Unexpected IDs")
+	}
+	text, err := st.MarshalText()
+	if err != nil {
+		t.Fatalf("Marshal error with \"%v\"", err)
+	}
+	st2 := NewSymbolTableWithNames("x")
+	if err := st2.UnmarshalText(text); err != nil {
+		t.Fatalf("Unmarshal error with \"%v\"", err)
+	}
+	if st2.Len() != 4 {
+		t.Fatalf("Unexpected length %d", st2.Len())
+	}
+	for i, name := range []string{"a", "b c", "d\ne", ""} {
+		if id, ok := st2.LookupSymbolID(name); !ok || id != SymbolID(i) {
+			t.Errorf("Unexpected ID %d for %q", id, name)
+		}
+	}
+	if _, ok := st2.LookupSymbolID("x"); ok {
+		t.Error("Old symbol remains")
+	}
+
+	if err := st2.UnmarshalText([]byte("\"a\"\n\"a\"\n")); err != ErrorDuplicateSymbol {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	if err := st2.UnmarshalText([]byte("a\n")); err == nil {
+		t.Error("Unquoted name was accepted")
+	}
+}
+
+func TestSymbolTableLookup(t *testing.T) {
+	st := NewSymbolTable()
+	if id, ok := st.LookupSymbolID("a"); ok || id != InvalidSymbolID {
+		t.Error("Unexpected lookup")
+	}
+	if st.Len() != 0 {
+		t.Error("Lookup registered a symbol")
+	}
+}
+
+func TestSymbolTableMerge(t *testing.T) {
+	st := NewSymbolTableWithNames("a", "b")
+	other := NewSymbolTableWithNames("c", "a")
+	remap := st.Merge(other)
+	if len(remap) != 2 || remap[0] != 2 || remap[1] != 0 {
+		t.Errorf("Unexpected remap %v", remap)
+	}
+
+	st.Freeze()
+	remap = st.Merge(NewSymbolTableWithNames("b", "z"))
+	if len(remap) != 1 || remap[0] != 1 {
+		t.Errorf("Unexpected remap %v", remap)
+	}
+}
+
+func TestSymbolTableFreeze(t *testing.T) {
+	st := NewSymbolTableWithNames("a", "quote")
+	st.Freeze()
+	if !st.IsFrozen() || st.GetSymbolID("a") != 0 || st.GetSymbolID("b") != InvalidSymbolID || st.Len() != 2 {
+		t.Fatal("Unexpected frozen table")
+	}
+
+	if _, err := ParseStringWithOptions("frozen.lsp", st, `(a 1 "s")`, ParseOptions{NumericType: true, ReaderMacros: true}); err != nil {
+		t.Errorf("Parse error with \"%v\"", err)
+	}
+	tests := []struct {
+		src  string
+		opts ParseOptions
+		pos  Position
+	}{
+		{"(a\n  b)", ParseOptions{}, Position{"frozen.lsp", 2, 3}},
+		{`(a "b")`, ParseOptions{StringAsSymbol: true}, Position{"frozen.lsp", 1, 4}},
+		{"(a `a)", ParseOptions{ReaderMacros: true}, Position{"frozen.lsp", 1, 4}},
+	}
+	for _, test := range tests {
+		_, err := ParseStringWithOptions("frozen.lsp", st, test.src, test.opts)
+		perr, ok := err.(*ParseError)
+		if !ok || perr.ID != ErrorUnknownSymbol || perr.ErrorLocation != test.pos {
+			t.Errorf("Unexpected error \"%v\" for %q", err, test.src)
+		}
+	}
+}
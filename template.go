@@ -0,0 +1,229 @@
+package listparser
+
+import "errors"
+
+// Template ,nameと,@nameのプレースホルダを含むリストの雛形
+type Template struct {
+	st                 *SymbolTable
+	body               *ListElement
+	symQuasiquote      SymbolID
+	symUnquote         SymbolID
+	symUnquoteSplicing SymbolID
+	placeholders       []SymbolID
+}
+
+// placeholderLookup プレースホルダに対応する値を返す。
+type placeholderLookup func(id SymbolID, pos Position) (SyntaxElement, error)
+
+// NewTemplate lstを雛形とするTemplateを作る。
+// lstが(quasiquote x)の形の場合はxを雛形とする。
+func NewTemplate(st *SymbolTable, lst *ListElement) (*Template, error) {
+	t := &Template{
+		st:                 st,
+		symQuasiquote:      lookupSymbolID(st, readerMacroNames[tokQuasiquote]),
+		symUnquote:         lookupSymbolID(st, readerMacroNames[tokUnquote]),
+		symUnquoteSplicing: lookupSymbolID(st, readerMacroNames[unquoteSplicing]),
+		placeholders:       make([]SymbolID, 0),
+	}
+	if lst.Len() == 2 && IsSymbolID(lst.elements[0], t.symQuasiquote) {
+		body, ok := lst.elements[1].(*ListElement)
+		if !ok {
+			return nil, newParseError(lst.pos.Filename, lst.pos.Line, lst.pos.Column, ErrorTemplateMustBeASingleList, nil)
+		}
+		lst = body
+	}
+	if t.placeholderKind(lst, 0) != 0 {
+		return nil, newParseError(lst.pos.Filename, lst.pos.Line, lst.pos.Column, ErrorTemplateMustBeASingleList, nil)
+	}
+	t.body = lst
+	if err := t.collect(lst, 0, make(map[SymbolID]bool)); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseTemplate srcをリーダーマクロを有効にしてパースし、Templateを作る。
+// srcはリストを一つだけ含まなければならない。
+func ParseTemplate(filename string, st *SymbolTable, src string) (*Template, error) {
+	lists, err := ParseStringWithOptions(filename, st, src, ParseOptions{NumericType: true, ReaderMacros: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) != 1 {
+		return nil, newParseError(filename, 1, 1, ErrorTemplateMustBeASingleList, nil)
+	}
+	return NewTemplate(st, lists[0])
+}
+
+// Placeholders tに含まれるプレースホルダのシンボルを出現順に返す。
+func (t *Template) Placeholders() []SymbolID {
+	ids := make([]SymbolID, len(t.placeholders))
+	copy(ids, t.placeholders)
+	return ids
+}
+
+// placeholderKind lstが入れ子の深さdepthで展開されるプレースホルダならそのリーダーマクロの種類を返す。
+func (t *Template) placeholderKind(lst *ListElement, depth int) rune {
+	if depth != 0 || lst.Len() != 2 || lst.tail != nil {
+		return 0
+	}
+	if IsSymbolID(lst.elements[0], t.symUnquote) {
+		return tokUnquote
+	} else if IsSymbolID(lst.elements[0], t.symUnquoteSplicing) {
+		return unquoteSplicing
+	}
+	return 0
+}
+
+// nextDepth lstの子要素の準クオートの入れ子の深さを返す。
+func (t *Template) nextDepth(lst *ListElement, depth int) int {
+	if lst.Len() == 2 {
+		head := lst.elements[0]
+		if IsSymbolID(head, t.symQuasiquote) {
+			return depth + 1
+		} else if IsSymbolID(head, t.symUnquote) || IsSymbolID(head, t.symUnquoteSplicing) {
+			return depth - 1
+		}
+	}
+	return depth
+}
+
+func (t *Template) collect(lst *ListElement, depth int, seen map[SymbolID]bool) error {
+	if t.placeholderKind(lst, depth) != 0 {
+		id, ok := lst.elements[1].SymbolValue()
+		if !ok {
+			pos := lst.elements[1].Position()
+			return newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidPlaceholder, nil)
+		}
+		if !seen[id] {
+			seen[id] = true
+			t.placeholders = append(t.placeholders, id)
+		}
+		return nil
+	}
+	depth = t.nextDepth(lst, depth)
+	for _, e := range lst.elements {
+		if child, ok := e.(*ListElement); ok {
+			if err := t.collect(child, depth, seen); err != nil {
+				return err
+			}
+		}
+	}
+	if tail, ok := lst.tail.(*ListElement); ok {
+		return t.collect(tail, depth, seen)
+	}
+	return nil
+}
+
+// expand eのプレースホルダを置き換えた要素を返す。,@nameの場合は複数の要素になる。
+func (t *Template) expand(e SyntaxElement, depth int, lookup placeholderLookup) ([]SyntaxElement, error) {
+	lst, ok := e.(*ListElement)
+	if !ok {
+		return []SyntaxElement{e}, nil
+	}
+	if kind := t.placeholderKind(lst, depth); kind != 0 {
+		id, _ := lst.elements[1].SymbolValue()
+		v, err := lookup(id, lst.pos)
+		if err != nil {
+			return nil, err
+		}
+		if kind == tokUnquote {
+			return []SyntaxElement{v}, nil
+		}
+		spliced, ok := v.(*ListElement)
+		if !ok {
+			return nil, newParseError(lst.pos.Filename, lst.pos.Line, lst.pos.Column, ErrorSpliceMustBeAList, nil)
+		}
+		elements := make([]SyntaxElement, len(spliced.elements))
+		copy(elements, spliced.elements)
+		return elements, nil
+	}
+	depth = t.nextDepth(lst, depth)
+	lstnew := &ListElement{openchar: lst.openchar, elements: make([]SyntaxElement, 0, len(lst.elements)), pos: lst.pos, macro: lst.macro, tag: lst.tag}
+	for _, child := range lst.elements {
+		elements, err := t.expand(child, depth, lookup)
+		if err != nil {
+			return nil, err
+		}
+		lstnew.elements = append(lstnew.elements, elements...)
+	}
+	if lst.tail != nil {
+		elements, err := t.expand(lst.tail, depth, lookup)
+		if err != nil {
+			return nil, err
+		}
+		// "."の後ろに展開できるのは一つの要素だけ。
+		if len(elements) != 1 {
+			pos := lst.tail.Position()
+			return nil, newParseError(pos.Filename, pos.Line, pos.Column, ErrorInvalidDottedPair, nil)
+		}
+		lstnew.tail = elements[0]
+	}
+	return []SyntaxElement{lstnew}, nil
+}
+
+func (t *Template) instantiate(lookup placeholderLookup) (*ListElement, error) {
+	elements, err := t.expand(t.body, 0, lookup)
+	if err != nil {
+		return nil, err
+	}
+	return elements[0].(*ListElement), nil
+}
+
+func (t *Template) unboundError(id SymbolID, pos Position) error {
+	name, err := t.st.GetSymbolName(id)
+	if err != nil {
+		return err
+	}
+	return newParseError(pos.Filename, pos.Line, pos.Column, ErrorUnboundPlaceholder, errors.New(name))
+}
+
+// Instantiate tのプレースホルダをbindingsの値で置き換えた新しいリストを返す。
+// ,@nameに対応する値はリストでなければならず、その子要素が展開される。
+func (t *Template) Instantiate(bindings map[SymbolID]SyntaxElement) (*ListElement, error) {
+	return t.instantiate(func(id SymbolID, pos Position) (SyntaxElement, error) {
+		v, ok := bindings[id]
+		if !ok || v == nil {
+			return nil, t.unboundError(id, pos)
+		}
+		return v, nil
+	})
+}
+
+// InstantiateValues tのプレースホルダをGoの値で置き換えた新しいリストを返す。
+// 値はint、int64、float64、string、SymbolID、SyntaxElementまたはそれらのスライスでなければならない。
+// スライスはリストに変換される。変換された要素の位置はプレースホルダの位置になる。
+func (t *Template) InstantiateValues(values map[SymbolID]interface{}) (*ListElement, error) {
+	return t.instantiate(func(id SymbolID, pos Position) (SyntaxElement, error) {
+		v, ok := values[id]
+		if !ok || v == nil {
+			return nil, t.unboundError(id, pos)
+		}
+		return valueToElement(v, pos)
+	})
+}
+
+// valueToElement Goの値vを位置posの構文要素に変換する。
+func valueToElement(v interface{}, pos Position) (SyntaxElement, error) {
+	switch vv := v.(type) {
+	case SyntaxElement:
+		return vv, nil
+	case int:
+		return newLiteral(int64(vv), pos.Filename, pos.Line, pos.Column)
+	case []SyntaxElement:
+		lst := &ListElement{openchar: tokLeftParenthesis, elements: make([]SyntaxElement, len(vv)), pos: pos}
+		copy(lst.elements, vv)
+		return lst, nil
+	case []interface{}:
+		lst := &ListElement{openchar: tokLeftParenthesis, elements: make([]SyntaxElement, 0, len(vv)), pos: pos}
+		for _, item := range vv {
+			e, err := valueToElement(item, pos)
+			if err != nil {
+				return nil, err
+			}
+			lst.elements = append(lst.elements, e)
+		}
+		return lst, nil
+	}
+	return newLiteral(v, pos.Filename, pos.Line, pos.Column)
+}
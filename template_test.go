@@ -0,0 +1,96 @@
+package listparser
+
+import "testing"
+
+func TestTemplate1(t *testing.T) {
+	st := NewSymbolTable()
+	tmpl, err := ParseTemplate("TestTemplate1", st, "`(rule ,name (when ,@conds) (priority ,prio))")
+	if err != nil {
+		t.Fatalf("Template error with \"%v\"", err)
+	}
+	symName := st.GetSymbolID("name")
+	symConds := st.GetSymbolID("conds")
+	symPrio := st.GetSymbolID("prio")
+	ph := tmpl.Placeholders()
+	if len(ph) != 3 || ph[0] != symName || ph[1] != symConds || ph[2] != symPrio {
+		t.Errorf("Unexpected placeholders %v", ph)
+	}
+
+	conds, err := ParseString("conds", st, `(a b c)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	lst, err := tmpl.Instantiate(map[SymbolID]SyntaxElement{
+		symName:  &symbolIDElement{st.GetSymbolID("r1"), Position{"value", 1, 1}, ""},
+		symConds: conds[0],
+		symPrio:  &intElement{10, Position{"value", 1, 1}, ""},
+	})
+	if err != nil {
+		t.Fatalf("Instantiate error with \"%v\"", err)
+	}
+	if lst.Len() != 4 || !IsSymbolID(lst.ElementAt(0), st.GetSymbolID("rule")) || !IsSymbolID(lst.ElementAt(1), st.GetSymbolID("r1")) {
+		t.Error("Unexpected result")
+	}
+	when := lst.ElementAt(2).(*ListElement)
+	if when.Len() != 4 || !IsSymbolID(when.ElementAt(3), st.GetSymbolID("c")) {
+		t.Error("Unexpected splicing result")
+	}
+
+	lst, err = tmpl.InstantiateValues(map[SymbolID]interface{}{
+		symName:  st.GetSymbolID("r2"),
+		symConds: []interface{}{"x", 1.5},
+		symPrio:  3,
+	})
+	if err != nil {
+		t.Fatalf("Instantiate error with \"%v\"", err)
+	}
+	when = lst.ElementAt(2).(*ListElement)
+	if s, ok := when.StringAt(1); !ok || s != "x" {
+		t.Error("Unexpected string value")
+	}
+	prio := lst.ElementAt(3).(*ListElement)
+	if v, ok := prio.IntAt(1); !ok || v != 3 || prio.ElementAt(1).Position().Column != 39 {
+		t.Errorf("Unexpected priority at %v", prio.ElementAt(1).Position())
+	}
+}
+
+func TestTemplateNested(t *testing.T) {
+	st := NewSymbolTable()
+	tmpl, err := ParseTemplate("TestTemplateNested", st, "(a `(b ,c) ,d)")
+	if err != nil {
+		t.Fatalf("Template error with \"%v\"", err)
+	}
+	if ph := tmpl.Placeholders(); len(ph) != 1 || ph[0] != st.GetSymbolID("d") {
+		t.Errorf("Unexpected placeholders %v", ph)
+	}
+	lst, err := tmpl.InstantiateValues(map[SymbolID]interface{}{st.GetSymbolID("d"): 1})
+	if err != nil {
+		t.Fatalf("Instantiate error with \"%v\"", err)
+	}
+	if v, ok := lst.IntAt(2); !ok || v != 1 {
+		t.Error("Unexpected result")
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	st := NewSymbolTable()
+	if _, err := ParseTemplate("TestTemplateErrors", st, "(a ,1)"); err == nil || err.(*ParseError).ID != ErrorInvalidPlaceholder {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	if _, err := ParseTemplate("TestTemplateErrors", st, "(a) (b)"); err == nil || err.(*ParseError).ID != ErrorTemplateMustBeASingleList {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+
+	tmpl, err := ParseTemplate("TestTemplateErrors", st, "(a ,b ,@c)")
+	if err != nil {
+		t.Fatalf("Template error with \"%v\"", err)
+	}
+	_, err = tmpl.InstantiateValues(map[SymbolID]interface{}{st.GetSymbolID("c"): []interface{}{}})
+	if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorUnboundPlaceholder {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+	_, err = tmpl.InstantiateValues(map[SymbolID]interface{}{st.GetSymbolID("b"): 1, st.GetSymbolID("c"): 2})
+	if pe, ok := err.(*ParseError); !ok || pe.ID != ErrorSpliceMustBeAList {
+		t.Errorf("Unexpected error \"%v\"", err)
+	}
+}
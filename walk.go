@@ -0,0 +1,102 @@
+package listparser
+
+// WalkAction Walkに渡す関数が返す、走査の続け方
+type WalkAction int
+
+const (
+	// WalkContinue 子要素を含めて走査を続ける。
+	WalkContinue WalkAction = iota
+	// WalkSkipChildren 子要素を飛ばして走査を続ける。
+	WalkSkipChildren
+	// WalkStop 走査を止める。
+	WalkStop
+)
+
+// Walk eとその子孫を深さ優先で先行順に走査してfnを呼ぶ。
+// pathはeから見た各階層の添字の並びで、eそのものは空のpathになる。
+// pathは走査中に再利用されるので、fnの外で使う場合はコピーすること。
+// ドット対の"."の後ろの要素は、添字がLen()の最後の子要素として走査する。
+// 祖先のリストを参照する循環した子要素は走査しない。共有されているだけのリストは現れるたびに走査する。
+func Walk(e SyntaxElement, fn func(path []int, e SyntaxElement) WalkAction) {
+	walk(make([]int, 0), make(map[*ListElement]bool), e, fn)
+}
+
+func walk(path []int, ancestors map[*ListElement]bool, e SyntaxElement, fn func(path []int, e SyntaxElement) WalkAction) WalkAction {
+	lst, isList := e.(*ListElement)
+	if isList && ancestors[lst] {
+		return WalkContinue
+	}
+	action := fn(path, e)
+	if action != WalkContinue || !isList {
+		return action
+	}
+	ancestors[lst] = true
+	defer delete(ancestors, lst)
+	for i, child := range lst.elements {
+		if walk(append(path, i), ancestors, child, fn) == WalkStop {
+			return WalkStop
+		}
+	}
+	if lst.tail != nil && walk(append(path, len(lst.elements)), ancestors, lst.tail, fn) == WalkStop {
+		return WalkStop
+	}
+	return WalkContinue
+}
+
+// Inspect go/astのInspectと同じように、eとその子孫を深さ優先で走査してfnを呼ぶ。
+// fnがtrueを返した場合は子要素を走査し、その後にfn(nil)を呼ぶ。Walkと同じく循環した子要素は走査しない。
+func Inspect(e SyntaxElement, fn func(e SyntaxElement) bool) {
+	inspect(make(map[*ListElement]bool), e, fn)
+}
+
+func inspect(ancestors map[*ListElement]bool, e SyntaxElement, fn func(e SyntaxElement) bool) {
+	lst, isList := e.(*ListElement)
+	if e == nil || (isList && ancestors[lst]) || !fn(e) {
+		return
+	}
+	if isList {
+		ancestors[lst] = true
+		for _, child := range lst.elements {
+			inspect(ancestors, child, fn)
+		}
+		if lst.tail != nil {
+			inspect(ancestors, lst.tail, fn)
+		}
+		delete(ancestors, lst)
+	}
+	fn(nil)
+}
+
+// Transform eとその子孫を先行順に走査し、fnが置き換えた要素からなる新しい木を返す。
+// fnが(r, true)を返した場合はその要素をrに置き換えて子要素は走査しない。rがnilの場合は要素を取り除く。
+// (_, false)を返した場合、リストは子要素を変換した新しいリストになり、それ以外の要素はそのまま使われる。
+// e自体が取り除かれた場合はnilを返す。ドット対の"."の後ろの要素が取り除かれた場合は真リストになる。
+// 祖先のリストを参照する循環した子要素はfnを呼ばずに、その祖先を変換した新しいリストへの参照になる。
+func Transform(e SyntaxElement, fn func(path []int, e SyntaxElement) (SyntaxElement, bool)) SyntaxElement {
+	return transform(make([]int, 0), make(map[*ListElement]*ListElement), e, fn)
+}
+
+func transform(path []int, ancestors map[*ListElement]*ListElement, e SyntaxElement, fn func(path []int, e SyntaxElement) (SyntaxElement, bool)) SyntaxElement {
+	lst, isList := e.(*ListElement)
+	if lstnew, ok := ancestors[lst]; isList && ok {
+		return lstnew
+	}
+	if r, ok := fn(path, e); ok {
+		return r
+	}
+	if !isList {
+		return e
+	}
+	lstnew := &ListElement{openchar: lst.openchar, elements: make([]SyntaxElement, 0, len(lst.elements)), pos: lst.pos, macro: lst.macro, tag: lst.tag}
+	ancestors[lst] = lstnew
+	defer delete(ancestors, lst)
+	for i, child := range lst.elements {
+		if r := transform(append(path, i), ancestors, child, fn); r != nil {
+			lstnew.elements = append(lstnew.elements, r)
+		}
+	}
+	if lst.tail != nil {
+		lstnew.tail = transform(append(path, len(lst.elements)), ancestors, lst.tail, fn)
+	}
+	return lstnew
+}
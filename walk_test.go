@@ -0,0 +1,153 @@
+package listparser
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWalk1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestWalk1", st, `(a (b c) (d (e)) f)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	paths := make([]string, 0)
+	Walk(lists[0], func(path []int, e SyntaxElement) WalkAction {
+		paths = append(paths, fmt.Sprint(path))
+		if IsList(e) && IsSymbolID(e.(*ListElement).ElementAt(0), st.GetSymbolID("b")) {
+			return WalkSkipChildren
+		}
+		if IsSymbolID(e, st.GetSymbolID("e")) {
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	expected := []string{"[]", "[0]", "[1]", "[2]", "[2 0]", "[2 1]", "[2 1 0]"}
+	if fmt.Sprint(paths) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+}
+
+func TestInspect1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestInspect1", st, `(1 (2 3) (4))`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+
+	var sum int64
+	nils := 0
+	Inspect(lists[0], func(e SyntaxElement) bool {
+		if e == nil {
+			nils++
+			return false
+		}
+		if v, ok := e.IntValue(); ok {
+			sum += v
+		}
+		if lst, ok := e.(*ListElement); ok && lst.Len() == 1 {
+			return false
+		}
+		return true
+	})
+	if sum != 6 || nils != 5 {
+		t.Errorf("Unexpected result %d %d", sum, nils)
+	}
+}
+
+func TestTransform1(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseString("TestTransform1", st, `(1 (2 drop 3) x)`, true, false)
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	symDrop := st.GetSymbolID("drop")
+	symX := st.GetSymbolID("x")
+
+	r := Transform(lists[0], func(path []int, e SyntaxElement) (SyntaxElement, bool) {
+		if v, ok := e.IntValue(); ok {
+			return &intElement{v * 10, e.Position(), ""}, true
+		} else if IsSymbolID(e, symDrop) {
+			return nil, true
+		} else if IsSymbolID(e, symX) {
+			return &stringElement{"x", e.Position(), "", nil}, true
+		}
+		return nil, false
+	})
+	lst := r.(*ListElement)
+	if lst == lists[0] || lst.Len() != 3 {
+		t.Fatal("Unexpected result")
+	}
+	inner := lst.ElementAt(1).(*ListElement)
+	if v, ok := inner.IntAt(1); !ok || inner.Len() != 2 || v != 30 {
+		t.Error("Unexpected inner list")
+	}
+	if s, ok := lst.StringAt(2); !ok || s != "x" {
+		t.Error("Unexpected replacement")
+	}
+	if v, ok := lists[0].IntAt(0); !ok || v != 1 {
+		t.Error("Original tree was modified")
+	}
+}
+
+func TestWalkDottedPairs(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestWalkDottedPairs", st, `(a b . (c . d))`, ParseOptions{DottedPairs: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	paths := make([]string, 0)
+	Walk(lists[0], func(path []int, e SyntaxElement) WalkAction {
+		paths = append(paths, fmt.Sprint(path))
+		return WalkContinue
+	})
+	expected := []string{"[]", "[0]", "[1]", "[2]", "[2 0]", "[2 1]"}
+	if fmt.Sprint(paths) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+
+	d := st.GetSymbolID("d")
+	r := Transform(lists[0], func(path []int, e SyntaxElement) (SyntaxElement, bool) {
+		if IsSymbolID(e, d) {
+			return nil, true
+		}
+		return nil, false
+	})
+	if s, err := Sprint(st, r); err != nil || s != "(a b . (c))" {
+		t.Errorf("Unexpected result %s", s)
+	}
+}
+
+func TestWalkCycles(t *testing.T) {
+	st := NewSymbolTable()
+	lists, err := ParseStringWithOptions("TestWalkCycles", st, `#0=(a #1=(b #0#) #1#)`, ParseOptions{DatumLabels: true})
+	if err != nil {
+		t.Fatalf("Parse error with \"%v\"", err)
+	}
+	paths := make([]string, 0)
+	Walk(lists[0], func(path []int, e SyntaxElement) WalkAction {
+		paths = append(paths, fmt.Sprint(path))
+		return WalkContinue
+	})
+	expected := []string{"[]", "[0]", "[1]", "[1 0]", "[2]", "[2 0]"}
+	if fmt.Sprint(paths) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+
+	n := 0
+	Inspect(lists[0], func(e SyntaxElement) bool {
+		n++
+		return true
+	})
+	if n != 12 {
+		t.Errorf("Unexpected count %d", n)
+	}
+
+	r := Transform(lists[0], func(path []int, e SyntaxElement) (SyntaxElement, bool) {
+		return nil, false
+	}).(*ListElement)
+	if r == lists[0] || !Equal(r, lists[0]) || r.ElementAt(1).(*ListElement).ElementAt(1) != r {
+		t.Error("Unexpected transformed cycle")
+	}
+}